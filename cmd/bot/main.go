@@ -1,38 +1,166 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"kieAITelegram/internal/api"
 	"kieAITelegram/internal/bot"
 	"kieAITelegram/internal/config"
 	"kieAITelegram/internal/core"
 	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/enhance"
+	"kieAITelegram/internal/health"
 	"kieAITelegram/internal/i18n"
-	"log"
+	"kieAITelegram/internal/logging"
+	"kieAITelegram/internal/media"
+	"kieAITelegram/internal/metrics"
+	"kieAITelegram/internal/moderation"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	_ "time/tzdata" // QUOTA_TIMEZONE tetap bisa dipakai di container tanpa zoneinfo
 )
 
+// updatesStaleAfter: getUpdates memakai long polling 60 detik, jadi jeda lebih
+// lama dari ini berarti loop polling macet atau Telegram tidak bisa dihubungi.
+const updatesStaleAfter = 3 * time.Minute
+
 func main() {
-	cfg, err := config.LoadConfig()
+	// Subcommand ditulis sebelum flag, misal: kiebot selfcheck -config x.json
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		switch os.Args[1] {
+		case "selfcheck":
+			if !runSelfcheck(os.Args[2:]) {
+				os.Exit(1)
+			}
+			return
+		case "migrate":
+			if err := runMigrate(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q (available: selfcheck, migrate)\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
+	cfg, err := config.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(1)
 	}
 
-	if err := core.LoadRegistry("models.json"); err != nil {
-		log.Fatalf("Critical Error: %v", err)
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat, cfg.TelegramToken, cfg.KieAPIKey, cfg.MediaSecret, cfg.EnhanceAPIKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize logging: %v\n", err)
+		os.Exit(1)
 	}
-	fmt.Println("AI Models loaded from models.json")
+	slog.SetDefault(logger)
 
-	db, err := database.NewSQLiteDB(cfg.DBPath)
+	if err := core.LoadRegistry(cfg.ModelsPath); err != nil {
+		fatal("failed to load model registry", err)
+	}
+	if err := checkConfiguredModels(cfg); err != nil {
+		fatal("invalid model configuration", err)
+	}
+	slog.Info("AI models loaded", "path", cfg.ModelsPath)
+
+	db, err := database.Open(cfg.DBDriver, cfg.DBSource(), true)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("failed to initialize database", err)
 	}
 	defer db.Close()
 
-	kieClient := api.NewKieClient(cfg.KieAPIKey)
-	loc := i18n.NewLocalizer(cfg.DefaultLang)
+	kieClient := api.NewKieClient(cfg.KieAPIKey, cfg.KieHTTPTimeout)
+	loc := i18n.NewLocalizer(cfg.LocalesDir, cfg.DefaultLang)
+
+	telegramBot := bot.NewBot(cfg, db, kieClient, loc)
 
-	telegramBot := bot.NewBot(cfg.TelegramToken, db, kieClient, loc)
+	moderator, err := moderation.New(cfg.ModerationBlocklist, cfg.ModerationRulesFile, cfg.ModerationHookURL, cfg.ModerationHookTimeout)
+	if err != nil {
+		fatal("failed to load moderation rules", err)
+	}
+	telegramBot.Moderator = moderator
 
-	fmt.Println("System initialized. Bot is now running...")
+	if cfg.EnhanceAPIURL != "" {
+		apiKey := cfg.EnhanceAPIKey
+		if apiKey == "" {
+			apiKey = cfg.KieAPIKey
+		}
+		telegramBot.Enhancer = enhance.NewChatClient(cfg.EnhanceAPIURL, apiKey, cfg.EnhanceModel, cfg.EnhanceTimeout)
+	}
+
+	if cfg.HTTPAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+
+		dbCheck := health.Check{Name: "database", Run: db.Ping}
+		updatesCheck := health.Check{Name: "telegram_updates", Run: func(ctx context.Context) error {
+			last := telegramBot.LastPollSuccess()
+			if last.IsZero() {
+				return errors.New("getUpdates has not succeeded yet")
+			}
+			if age := time.Since(last); age > updatesStaleAfter {
+				return fmt.Errorf("last getUpdates success %s ago", age.Round(time.Second))
+			}
+			return nil
+		}}
+		registryCheck := health.Check{Name: "registry", Run: func(ctx context.Context) error {
+			if !core.Loaded() {
+				return errors.New("model registry is empty")
+			}
+			return nil
+		}}
+		kieCheck := health.Cached(health.Check{Name: "kie", Run: kieClient.Ping}, 30*time.Second)
+
+		mux.Handle("/healthz", health.Handler(5*time.Second, dbCheck, updatesCheck))
+		mux.Handle("/readyz", health.Handler(10*time.Second, dbCheck, registryCheck, updatesCheck, kieCheck))
+
+		if cfg.MediaPublicURL != "" {
+			mediaStore, err := media.NewStore(cfg.MediaDir, cfg.MediaPublicURL, cfg.MediaSecret, cfg.MediaRetention, cfg.MediaLinkTTL)
+			if err != nil {
+				fatal("failed to initialize media store", err)
+			}
+			go mediaStore.RunJanitor(time.Hour)
+			mux.Handle("/media/", mediaStore)
+			telegramBot.Media = mediaStore
+			slog.Info("media proxy enabled", "url", cfg.MediaPublicURL)
+		}
+
+		go func() {
+			if err := http.ListenAndServe(cfg.HTTPAddr, mux); err != nil {
+				fatal("HTTP server error", err)
+			}
+		}()
+	}
+
+	// SIGINT/SIGTERM: berhenti polling dan batalkan job yang sedang berjalan
+	// sebelum database ditutup.
+	sigCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	go func() {
+		<-sigCtx.Done()
+		slog.Info("shutting down")
+		telegramBot.Stop()
+	}()
+
+	slog.Info("system initialized, bot is now running")
 	telegramBot.Start()
+	slog.Info("bot stopped")
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
\ No newline at end of file
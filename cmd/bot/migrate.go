@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"kieAITelegram/internal/config"
+	"kieAITelegram/internal/database"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = `usage: kiebot migrate <command> [flags]
+
+commands:
+  status        list migrations and whether they are applied
+  up            apply all pending migrations
+  down-to N     roll back applied migrations newer than version N`
+
+// runMigrate menjalankan subcommand migrate. Hanya setting database yang
+// dibutuhkan, jadi config tidak divalidasi penuh (token tidak wajib).
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+	command, args := args[0], args[1:]
+
+	target := 0
+	if command == "down-to" {
+		if len(args) == 0 {
+			return fmt.Errorf("down-to needs a target version\n\n%s", migrateUsage)
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid target version %q", args[0])
+		}
+		target, args = n, args[1:]
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+	db, err := database.Open(cfg.DBDriver, cfg.DBSource(), false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch command {
+	case "status":
+	case "up":
+		if err := db.Migrate(); err != nil {
+			return err
+		}
+	case "down-to":
+		if err := db.MigrateDownTo(target); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", command, migrateUsage)
+	}
+
+	status, err := db.MigrationStatus()
+	for _, m := range status {
+		state := "pending"
+		if m.Applied {
+			state = "applied " + m.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(os.Stdout, "%04d  %-32s %s\n", m.Version, m.Name, state)
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"kieAITelegram/internal/config"
+	"kieAITelegram/internal/core"
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/i18n"
+	"kieAITelegram/internal/models"
+	"kieAITelegram/internal/moderation"
+)
+
+// runSelfcheck memvalidasi config, registry model, file locale, aturan
+// moderasi dan skema database tanpa menjalankan bot. Return false jika ada masalah.
+func runSelfcheck(args []string) bool {
+	ok := true
+	report := func(name string, err error) {
+		if err != nil {
+			ok = false
+			fmt.Printf("FAIL %s:\n%v\n", name, err)
+			return
+		}
+		fmt.Printf("OK   %s\n", name)
+	}
+
+	cfg, err := config.LoadConfig(args)
+	report("config", err)
+	if err != nil {
+		return false
+	}
+
+	err = core.LoadRegistry(cfg.ModelsPath)
+	if err == nil && !core.Loaded() {
+		err = fmt.Errorf("%s contains no models", cfg.ModelsPath)
+	}
+	if err == nil {
+		err = checkConfiguredModels(cfg)
+	}
+	report("registry", err)
+
+	report("locales", i18n.CheckLocales(cfg.LocalesDir, cfg.DefaultLang))
+	_, err = moderation.LoadRules(cfg.ModerationBlocklist, cfg.ModerationRulesFile)
+	report("moderation rules", err)
+	report("database schema", database.CheckSchema(cfg.DBDriver, cfg.DBSource()))
+
+	return ok
+}
+
+// checkConfiguredModels memastikan model yang dipilih lewat config ada di
+// registry. Dipanggil setelah core.LoadRegistry, saat start maupun selfcheck.
+func checkConfiguredModels(cfg *models.Config) error {
+	if cfg.InlineDefaultModel != "" && core.GetModelByID(cfg.InlineDefaultModel) == nil {
+		return fmt.Errorf("INLINE_DEFAULT_MODEL %q is not in %s", cfg.InlineDefaultModel, cfg.ModelsPath)
+	}
+	if cfg.EditDefaultModel != "" {
+		if m := core.GetModelByID(cfg.EditDefaultModel); m == nil {
+			return fmt.Errorf("EDIT_DEFAULT_MODEL %q is not in %s", cfg.EditDefaultModel, cfg.ModelsPath)
+		} else if !m.Supports("image_input") {
+			return fmt.Errorf("EDIT_DEFAULT_MODEL %q does not support image_input", cfg.EditDefaultModel)
+		}
+	}
+	if cfg.AnimateModel != "" {
+		if m := core.GetModelByID(cfg.AnimateModel); m == nil {
+			return fmt.Errorf("ANIMATE_MODEL %q is not in %s", cfg.AnimateModel, cfg.ModelsPath)
+		} else if !m.Supports("image_input") || core.ModelType(m.ID) != "video" {
+			return fmt.Errorf("ANIMATE_MODEL %q must be a video model that supports image_input", cfg.AnimateModel)
+		}
+	}
+	return nil
+}
@@ -2,32 +2,79 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"kieAITelegram/internal/metrics"
 	"kieAITelegram/internal/models"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 )
 
 type KieClient struct {
-	APIKey     string
-	BaseURL    string
-	HTTPClient *http.Client
+	APIKey        string
+	BaseURL       string
+	UploadBaseURL string
+	HTTPClient    *http.Client
 }
 
-func NewKieClient(apiKey string) *KieClient {
+func NewKieClient(apiKey string, timeout time.Duration) *KieClient {
 	return &KieClient{
-		APIKey:  apiKey,
-		BaseURL: "https://api.kie.ai/api/v1",
+		APIKey:        apiKey,
+		BaseURL:       "https://api.kie.ai/api/v1",
+		UploadBaseURL: "https://kieai.redpandaai.co",
 		HTTPClient: &http.Client{
-			Timeout: 60 * time.Second,
+			Timeout: timeout,
 		},
 	}
 }
 
+// do mengirim request ke Kie sambil mencatat latency dan error per operasi.
+// Status selain 200 juga dihitung sebagai error.
+func (c *KieClient) do(op string, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.HTTPClient.Do(req)
+	metrics.KieRequestDuration.Observe(time.Since(start).Seconds(), op)
+	if err != nil || resp.StatusCode != 200 {
+		metrics.KieErrorsTotal.Inc(op)
+	}
+	return resp, err
+}
+
+// Ping checks that Kie is reachable and accepts the API key by querying the
+// account credit, which does not start any task.
+func (c *KieClient) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/chat/credit", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Kie status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("Kie parse error: %v", err)
+	}
+	if body.Code != 200 {
+		return fmt.Errorf("Kie error %d: %s", body.Code, body.Msg)
+	}
+	return nil
+}
+
 func (c *KieClient) CreateTaskComplex(prompt string, modelName string, options map[string]interface{}) (string, error) {
 	getOpt := func(key string, def string) string {
 		if val, ok := options[key]; ok {
@@ -165,7 +212,7 @@ func (c *KieClient) CreateTaskComplex(prompt string, modelName string, options m
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.APIKey)
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do("create", req)
 	if err != nil {
 		return "", err
 	}
@@ -174,7 +221,7 @@ func (c *KieClient) CreateTaskComplex(prompt string, modelName string, options m
 	bodyBytes, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode != 200 {
-		log.Printf("API Error Status: %d | Body: %s", resp.StatusCode, string(bodyBytes))
+		slog.Warn("Kie API error", "status", resp.StatusCode, "body", string(bodyBytes))
 		return "", fmt.Errorf("API error status %d", resp.StatusCode)
 	}
 
@@ -184,6 +231,7 @@ func (c *KieClient) CreateTaskComplex(prompt string, modelName string, options m
 	}
 
 	if kieResp.Code != 200 {
+		metrics.KieErrorsTotal.Inc("create")
 		return "", fmt.Errorf("API error %d: %s", kieResp.Code, kieResp.Msg)
 	}
 
@@ -206,7 +254,7 @@ func (c *KieClient) GetTaskStatus(taskID string, modelName string) (*models.KieQ
 	}
 	req.Header.Set("Authorization", "Bearer "+c.APIKey)
 
-	resp, err := c.HTTPClient.Do(req)
+	resp, err := c.do("poll", req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// Folder di storage Kie untuk gambar yang diupload user lewat Telegram.
+const telegramUploadPath = "telegram-uploads"
+
+type kieUploadResponse struct {
+	Success bool   `json:"success"`
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	Data    struct {
+		FileName    string `json:"fileName"`
+		DownloadURL string `json:"downloadUrl"`
+	} `json:"data"`
+}
+
+// UploadFile re-hosts a file on Kie's temporary file storage and returns its
+// public download URL. Kie keeps uploaded files for a limited time only. The
+// file is streamed through an io.Pipe, so it is never held in memory as a
+// whole.
+func (c *KieClient) UploadFile(r io.Reader, fileName string) (string, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		writer.WriteField("uploadPath", telegramUploadPath)
+		writer.WriteField("fileName", fileName)
+
+		part, err := writer.CreateFormFile("file", fileName)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+	// Pastikan goroutine penulis berhenti jika request gagal sebelum body habis dibaca.
+	defer pr.Close()
+
+	req, err := http.NewRequest("POST", c.UploadBaseURL+"/api/file-stream-upload", pr)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.do("upload", req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("upload error status %d", resp.StatusCode)
+	}
+
+	var uploadResp kieUploadResponse
+	if err := json.Unmarshal(bodyBytes, &uploadResp); err != nil {
+		return "", fmt.Errorf("upload parse error: %s", string(bodyBytes))
+	}
+	if !uploadResp.Success || uploadResp.Data.DownloadURL == "" {
+		return "", fmt.Errorf("upload error %d: %s", uploadResp.Code, uploadResp.Msg)
+	}
+
+	return uploadResp.Data.DownloadURL, nil
+}
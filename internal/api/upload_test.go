@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadFileStreamsMultipart(t *testing.T) {
+	const content = "\x89PNG fake image"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/file-stream-upload" || r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		// Body di-stream, jadi panjangnya tidak diketahui di depan.
+		if r.ContentLength != -1 {
+			t.Errorf("content length = %d, want a streamed body", r.ContentLength)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("form file: %v", err)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		if string(data) != content || header.Filename != "photo.png" {
+			t.Errorf("file = %q (%s)", data, header.Filename)
+		}
+		if r.FormValue("uploadPath") != telegramUploadPath || r.FormValue("fileName") != "photo.png" {
+			t.Errorf("fields = %v", r.MultipartForm.Value)
+		}
+		fmt.Fprint(w, `{"success":true,"code":200,"data":{"downloadUrl":"https://files.example.com/photo.png"}}`)
+	}))
+	defer srv.Close()
+
+	c := NewKieClient("key", time.Second)
+	c.UploadBaseURL = srv.URL
+	got, err := c.UploadFile(strings.NewReader(content), "photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "https://files.example.com/photo.png" {
+		t.Fatalf("url = %q", got)
+	}
+}
+
+func TestUploadFileReaderError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		fmt.Fprint(w, `{"success":true,"code":200,"data":{"downloadUrl":"https://files.example.com/x"}}`)
+	}))
+	defer srv.Close()
+
+	c := NewKieClient("key", time.Second)
+	c.UploadBaseURL = srv.URL
+	_, err := c.UploadFile(io.MultiReader(strings.NewReader("part"), errReader{}), "photo.png")
+	if err == nil {
+		t.Fatal("upload of a broken reader succeeded")
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, fmt.Errorf("telegram download broke") }
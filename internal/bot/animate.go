@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"kieAITelegram/internal/core"
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/models"
+)
+
+// handleAnimate handles the Animate button on an image result: it selects
+// ANIMATE_MODEL with the result as image_input and a ratio matching the image,
+// then opens the model dashboard so the user only has to type the motion
+// prompt.
+func (b *Bot) handleAnimate(lg *slog.Logger, chatID int64, userID int64, msg *models.TelegramMessage, parts []string, lang string) {
+	if len(parts) < 2 {
+		return
+	}
+	jobID, _ := strconv.ParseInt(parts[1], 10, 64)
+	job, err := b.DB.GetJob(jobID)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	if err != nil || job.UserID != userID || job.Kind != "image" || job.ResultURL == "" {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "animate_unavailable"))
+		return
+	}
+	model := core.GetModelByID(b.Cfg.AnimateModel)
+	if model == nil {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "error_model_not_found"))
+		return
+	}
+
+	imageURL := b.resultLink(resultSource{URL: job.ResultURL, Name: job.MediaName})
+	width, height := photoSize(msg)
+	ratio := ratioForImage(model, width, height)
+	err = b.DB.UpdateUserState(userID, func(state *database.UserState) error {
+		state.State = "WAITING_PROMPT"
+		state.SelectedModel = model.ID
+		// Draft baru seperti saat model dipilih dari menu; opsi model
+		// sebelumnya (misal resolution) tidak ikut terbawa.
+		state.DraftOptions = newDraft(model)
+		state.DraftOptions["image_input"] = []string{imageURL}
+		if ratio != "" {
+			state.DraftOptions["ratio"] = ratio
+		} else if len(model.Ratios) > 0 {
+			state.DraftOptions["ratio"] = model.Ratios[0]
+		}
+		return nil
+	})
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	lg.Info("animating result", "source_job", job.ID, "model", model.ID, "ratio", ratio)
+	// Pesan hasil berupa foto tidak bisa diedit jadi dashboard; kirim pesan baru.
+	b.showModelDashboard(chatID, 0, userID, model.ID, lang)
+}
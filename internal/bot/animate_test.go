@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/models"
+)
+
+func TestAnimateStartsWithFreshDraft(t *testing.T) {
+	b, tg := newTestBot(t)
+	const userID = int64(300)
+	const resultURL = "https://example.com/result.png"
+
+	jobID, err := b.DB.CreateJob(userID, userID, "nano-banana-pro", "image", "a cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DB.FinishJob(jobID, "success", resultURL, ""); err != nil {
+		t.Fatal(err)
+	}
+	// Draft dari model sebelumnya, termasuk opsi yang tidak dimiliki Veo.
+	err = b.DB.UpdateUserState(userID, func(state *database.UserState) error {
+		state.State = "WAITING_PROMPT"
+		state.SelectedModel = "nano-banana-pro"
+		state.DraftOptions = map[string]interface{}{
+			"ratio":       "1:1",
+			"format":      "jpeg",
+			"resolution":  "4K",
+			"image_input": []string{"https://example.com/old.png"},
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := privateMessage(userID, "")
+	msg.MessageID = 10
+	msg.Photo = []models.PhotoSize{{Width: 90, Height: 160}, {Width: 720, Height: 1280}}
+	b.handleCallback(b.Log, &models.CallbackQuery{
+		ID:      "cb",
+		Data:    fmt.Sprintf("anim:%d", jobID),
+		From:    &models.User{ID: userID},
+		Message: msg,
+	})
+
+	state, err := b.DB.GetUserState(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.State != "WAITING_PROMPT" || state.SelectedModel != b.Cfg.AnimateModel {
+		t.Fatalf("state = %+v, want WAITING_PROMPT on %s", state, b.Cfg.AnimateModel)
+	}
+	want := map[string]interface{}{
+		"ratio":       "9:16",
+		"format":      "png",
+		"image_input": []interface{}{resultURL},
+	}
+	if !reflect.DeepEqual(state.DraftOptions, want) {
+		t.Fatalf("draft = %v\nwant    %v", state.DraftOptions, want)
+	}
+	// Dashboard dikirim sebagai pesan baru, bukan edit pesan foto.
+	if len(tg.Calls("sendMessage")) != 1 || len(tg.Calls("editMessageText")) != 0 {
+		t.Fatalf("dashboard not sent as a new message: send=%d edit=%d",
+			len(tg.Calls("sendMessage")), len(tg.Calls("editMessageText")))
+	}
+}
+
+func TestSelectModelStartsWithFreshDraft(t *testing.T) {
+	b, _ := newTestBot(t)
+	const userID = int64(301)
+	err := b.DB.UpdateUserState(userID, func(state *database.UserState) error {
+		state.SelectedModel = "nano-banana-pro"
+		state.DraftOptions = map[string]interface{}{"ratio": "4:3", "resolution": "4K", "format": "jpeg"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := privateMessage(userID, "")
+	msg.MessageID = 10
+	b.handleCallback(b.Log, &models.CallbackQuery{
+		ID:      "cb",
+		Data:    "model:nano-banana",
+		From:    &models.User{ID: userID},
+		Message: msg,
+	})
+
+	state, err := b.DB.GetUserState(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"ratio": "1:1", "format": "png", "image_input": []interface{}{}}
+	if !reflect.DeepEqual(state.DraftOptions, want) {
+		t.Fatalf("draft = %v\nwant    %v", state.DraftOptions, want)
+	}
+}
+
+func TestAnimateButtonOnDocumentResult(t *testing.T) {
+	b, tg := newTestBot(t)
+	b.Cfg.SendAsDocument = true
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(img.Bytes())
+	}))
+	defer files.Close()
+
+	src := resultSource{URL: files.URL + "/result.png"}
+	if got := b.deliverResult(b.Log, 400, 7, src, "", "en", false); got != methodDocument {
+		t.Fatalf("method = %v, want sendDocument", got.Method)
+	}
+	markup, _ := tg.Last(t, "sendDocument").Body["reply_markup"].(string)
+	if !strings.Contains(markup, `"anim:7"`) || !strings.Contains(markup, `"orig:7"`) {
+		t.Fatalf("reply_markup = %q, want the original and Animate buttons", markup)
+	}
+}
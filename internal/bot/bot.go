@@ -1,69 +1,139 @@
 package bot
 
 import (
-	"bytes"
 	"encoding/json"
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"kieAITelegram/internal/api"
 	"kieAITelegram/internal/core"
 	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/enhance"
 	"kieAITelegram/internal/i18n"
+	"kieAITelegram/internal/media"
+	"kieAITelegram/internal/metrics"
+	"kieAITelegram/internal/moderation"
 	"kieAITelegram/internal/models"
-	"log"
-	"mime/multipart"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Bot struct {
+	Cfg       *models.Config
 	Token     string
 	APIURL    string
-	DB        *database.SQLiteDB
+	DB        database.Store
 	KieClient *api.KieClient
 	Localizer *i18n.Localizer
+	Media     *media.Store // nil jika media server tidak diaktifkan
+	Moderator moderation.Moderator // nil jika moderasi tidak dikonfigurasi
+	Enhancer  enhance.Enhancer     // nil jika prompt enhancer tidak dikonfigurasi
+	Log       *slog.Logger
 	Offset    int64
 	activeTasks map[int64]context.CancelFunc 
+	mediaGroups map[string]*pendingMediaGroup
 	mu          sync.Mutex
+	dispatch    *dispatcher
+	out         *sender
+	quotaLoc    *time.Location
+	fileURL     string // base URL download file Telegram (berisi token)
+	download    *http.Client // download hasil Kie dan file Telegram, dengan timeout
+	username    string // username bot dari getMe, diisi saat pertama dibutuhkan
+
+	lastPollOK atomic.Int64 // unix nano getUpdates terakhir yang sukses
+
+	// Lifecycle bot: dibatalkan oleh Stop, semua job turunan ikut berhenti.
+	ctx  context.Context
+	stop context.CancelFunc
+	jobs sync.WaitGroup
 }
 
-func NewBot(token string, db *database.SQLiteDB, kie *api.KieClient, loc *i18n.Localizer) *Bot {
+func NewBot(cfg *models.Config, db database.Store, kie *api.KieClient, loc *i18n.Localizer) *Bot {
+	// Sudah divalidasi oleh config; UTC hanya untuk berjaga-jaga.
+	quotaLoc, err := time.LoadLocation(cfg.QuotaTimezone)
+	if err != nil {
+		quotaLoc = time.UTC
+	}
+	apiBase := strings.TrimRight(cfg.TelegramAPIURL, "/")
+	ctx, stop := context.WithCancel(context.Background())
+
 	return &Bot{
-		Token:     token,
-		APIURL:    "https://api.telegram.org/bot" + token,
+		Cfg:       cfg,
+		Token:     cfg.TelegramToken,
+		APIURL:    apiBase + "/bot" + cfg.TelegramToken,
 		DB:        db,
 		KieClient: kie,
 		Localizer: loc,
+		Log:       slog.Default(),
 		Offset:    0,
 		activeTasks: make(map[int64]context.CancelFunc),
+		mediaGroups: make(map[string]*pendingMediaGroup),
+		dispatch:    newDispatcher(cfg.UpdateWorkers, cfg.UpdateQueueSize),
+		out:         newSender(apiBase + "/bot" + cfg.TelegramToken),
+		quotaLoc:    quotaLoc,
+		fileURL:     apiBase + "/file/bot" + cfg.TelegramToken,
+		download:    &http.Client{Timeout: cfg.UploadTimeout},
+		ctx:         ctx,
+		stop:        stop,
 	}
 }
 
+// Start polls for updates until Stop is called. It returns after running
+// jobs have been canceled and recorded.
 func (b *Bot) Start() {
-	log.Println("Bot started polling...")
-	for {
+	b.resumeBroadcasts()
+	b.Log.Info("bot started polling")
+	defer b.jobs.Wait()
+	for b.ctx.Err() == nil {
 		updates, err := b.getUpdates()
+		if b.ctx.Err() != nil {
+			break
+		}
 		if err != nil {
-			log.Printf("Error updates: %v", err)
+			b.Log.Error("getUpdates failed", "err", err)
 			time.Sleep(5 * time.Second)
 			continue
 		}
+		b.lastPollOK.Store(time.Now().UnixNano())
 		for _, update := range updates {
 			if update.UpdateID >= b.Offset {
 				b.Offset = update.UpdateID + 1
 			}
-			go b.handleUpdate(update)
+			b.dispatch.Dispatch(updateKey(update), func() { b.handleUpdate(update) })
 		}
 		time.Sleep(1 * time.Second)
 	}
 }
 
+// Stop stops polling and cancels running jobs; Start returns once they are done.
+func (b *Bot) Stop() {
+	b.stop()
+}
+
+// LastPollSuccess returns when getUpdates last succeeded, or the zero time if
+// it never has.
+func (b *Bot) LastPollSuccess() time.Time {
+	n := b.lastPollOK.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
 func (b *Bot) getUpdates() ([]models.TelegramUpdate, error) {
 	url := fmt.Sprintf("%s/getUpdates?offset=%d&timeout=60", b.APIURL, b.Offset)
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(b.ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -72,47 +142,189 @@ func (b *Bot) getUpdates() ([]models.TelegramUpdate, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, err
 	}
+	if !result.Ok {
+		return nil, fmt.Errorf("getUpdates returned status %d", resp.StatusCode)
+	}
 	return result.Result, nil
 }
 
 func (b *Bot) handleUpdate(u models.TelegramUpdate) {
+	lg := b.Log.With("update_id", u.UpdateID)
+	switch {
+	case u.Message != nil:
+		lg = lg.With("user_id", u.Message.From.ID, "chat_id", u.Message.Chat.ID)
+	case u.CallbackQuery != nil:
+		lg = lg.With("user_id", u.CallbackQuery.From.ID)
+		if u.CallbackQuery.Message != nil {
+			lg = lg.With("chat_id", u.CallbackQuery.Message.Chat.ID)
+		}
+	case u.InlineQuery != nil:
+		lg = lg.With("user_id", u.InlineQuery.From.ID)
+	case u.ChosenInlineResult != nil:
+		lg = lg.With("user_id", u.ChosenInlineResult.From.ID)
+	case u.PreCheckoutQuery != nil:
+		lg = lg.With("user_id", u.PreCheckoutQuery.From.ID)
+	}
+	lg.Debug("update received")
+	metrics.UpdatesTotal.Inc(updateType(u))
+
+	if userID := privateChatUser(u); userID != 0 {
+		if err := b.DB.TouchUser(userID); err != nil {
+			lg.Warn("failed to record user activity", "err", err)
+		}
+	}
+
+	if u.InlineQuery != nil {
+		b.handleInlineQuery(lg, u.InlineQuery)
+		return
+	}
+	if u.ChosenInlineResult != nil {
+		b.handleChosenInlineResult(lg, u.ChosenInlineResult)
+		return
+	}
+	if u.PreCheckoutQuery != nil {
+		b.handlePreCheckout(lg, u.PreCheckoutQuery)
+		return
+	}
 	if u.CallbackQuery != nil {
-		b.handleCallback(u.CallbackQuery)
+		b.handleCallback(lg, u.CallbackQuery)
 		return
 	}
 	if u.Message != nil {
+		if u.Message.SuccessfulPayment != nil {
+			b.handleSuccessfulPayment(lg, u.Message)
+		}
+		if u.Message.RefundedPayment != nil {
+			b.handleRefundedPayment(lg, u.Message)
+		}
 		if u.Message.Text != "" {
-			b.handleMessage(u.Message)
+			b.handleMessage(lg, u.Message)
 		}
-		if len(u.Message.Photo) > 0 {
-			b.handlePhotoUpload(u.Message)
+		if len(u.Message.Photo) > 0 || u.Message.Document != nil {
+			b.handleImageUpload(lg, u.Message)
 		}
 	}
 }
 
-func (b *Bot) handleMessage(msg *models.TelegramMessage) {
+// commandName mengembalikan perintah di awal teks tanpa akhiran @namabot,
+// misal "/broadcast" untuk "/broadcast@kiebot lang=id".
+func commandName(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+	name, _, _ := strings.Cut(fields[0], "@")
+	return name
+}
+
+// privateChatUser mengembalikan user yang berinteraksi lewat chat pribadi
+// (jadi bisa menerima broadcast), atau 0.
+func privateChatUser(u models.TelegramUpdate) int64 {
+	switch {
+	case u.Message != nil && u.Message.From != nil && u.Message.Chat.Type == "private":
+		return u.Message.From.ID
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil && u.CallbackQuery.Message.Chat.Type == "private":
+		return u.CallbackQuery.From.ID
+	}
+	return 0
+}
+
+func updateType(u models.TelegramUpdate) string {
+	switch {
+	case u.InlineQuery != nil:
+		return "inline_query"
+	case u.ChosenInlineResult != nil:
+		return "chosen_inline_result"
+	case u.PreCheckoutQuery != nil:
+		return "pre_checkout_query"
+	case u.CallbackQuery != nil:
+		return "callback_query"
+	case u.Message != nil:
+		return "message"
+	}
+	return "other"
+}
+
+func (b *Bot) handleMessage(lg *slog.Logger, msg *models.TelegramMessage) {
 	text := strings.TrimSpace(msg.Text)
 	chatID := msg.Chat.ID
 	userID := msg.From.ID
-	lang := b.DB.GetUserLanguage(userID)
+	lang := b.userLang(userID)
 
-	if text == "/start" {
-		b.DB.SetUserState(userID, "IDLE", "")
+	if commandName(text) == "/start" {
+		if err := b.DB.SetUserState(userID, "IDLE", ""); err != nil {
+			b.storeFailed(lg, chatID, lang, err)
+			return
+		}
 		// Parameter: chatID, messageID(0), isEdit(false), lang
 		b.showMainMenu(chatID, 0, false, lang)
+		// Deep link: "/start <payload>"
+		if fields := strings.Fields(text); len(fields) > 1 {
+			b.handleStartPayload(lg, chatID, userID, fields[1], lang)
+		}
+		return
+	}
+
+	if commandName(text) == "/invite" {
+		b.showInvite(lg, chatID, userID, lang)
+		return
+	}
+
+	if commandName(text) == "/broadcast" && b.Cfg.IsAdmin(userID) {
+		b.handleBroadcastCommand(lg, chatID, userID, msg.Text, lang)
+		return
+	}
+
+	if commandName(text) == "/settier" && b.Cfg.IsAdmin(userID) {
+		b.handleSetTier(lg, chatID, text, lang)
+		return
+	}
+
+	if commandName(text) == "/refund" && b.Cfg.IsAdmin(userID) {
+		b.handleRefund(lg, chatID, text, lang)
+		return
+	}
+
+	if commandName(text) == "/modlog" && b.Cfg.IsAdmin(userID) {
+		b.handleModLog(lg, chatID, text, lang)
+		return
+	}
+
+	if commandName(text) == "/unban" && b.Cfg.IsAdmin(userID) {
+		b.handleUnban(lg, chatID, text, lang)
+		return
+	}
+
+	if commandName(text) == "/buy" {
+		b.showBuyMenu(lg, chatID, userID, lang)
+		return
+	}
+
+	if commandName(text) == "/quota" {
+		b.showQuota(lg, chatID, userID, lang)
 		return
 	}
 
-	if text == "/cancel" {
+	if commandName(text) == "/cancel" {
 		b.handleCancel(chatID, userID, lang)
 		return
 	}
 
+	if commandName(text) == "/history" {
+		b.showHistory(lg, chatID, 0, userID, 0, lang)
+		return
+	}
+
 	if text == "/lang" {
 		b.showLanguageMenu(chatID, 0, false, lang)
 		return
 	}
 
+	if text == "/settings" {
+		b.showSettings(chatID, 0, false, userID, lang)
+		return
+	}
+
 	if text == "/img" {
 		b.showProviders(chatID, 0, false, lang, false)
 		return
@@ -123,82 +335,67 @@ func (b *Bot) handleMessage(msg *models.TelegramMessage) {
 		return
 	}
 
-	state := b.DB.GetUserState(userID)
-	
+	// Balasan teks ke pesan hasil = edit hasil tersebut.
+	if b.handleReplyEdit(lg, msg, text, lang) {
+		return
+	}
+
+	state, err := b.DB.GetUserState(userID)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+
 	if state.State == "WAITING_IMAGE_UPLOAD" {
 		b.sendMessage(chatID, b.Localizer.Get(lang, "upload_warn_wrong_mode"))
 		return
 	}
 
 	if state.State == "WAITING_PROMPT" && state.SelectedModel != "" {
-		b.processImageGeneration(chatID, userID, text, state, lang)
+		b.handlePrompt(lg, chatID, userID, text, state, lang)
+	} else if state.State == stateWaitingPromptEdit && state.SelectedModel != "" {
+		b.handleEditedPrompt(lg, chatID, userID, text, state, lang)
 	} else {
 		b.sendMessage(chatID, b.Localizer.Get(lang, "start_hint"))
 	}
 }
 
-func (b *Bot) handlePhotoUpload(msg *models.TelegramMessage) {
-	chatID := msg.Chat.ID
-	userID := msg.From.ID
-	state := b.DB.GetUserState(userID)
-	lang := b.DB.GetUserLanguage(userID)
-
-	if state.State != "WAITING_IMAGE_UPLOAD" {
-		return 
-	}
-
-	bestPhoto := msg.Photo[len(msg.Photo)-1]
-	fileURL, err := b.getFileDirectURL(bestPhoto.FileID)
-	if err != nil {
-		log.Printf("Error getting file URL: %v", err)
-		b.sendMessage(chatID, b.Localizer.Get(lang, "upload_fail_url"))
-		return
-	}
-
-	currentOpts := state.DraftOptions
-	var imageList []string
-
-	if existing, ok := currentOpts["image_input"]; ok {
-		if listInterface, ok := existing.([]interface{}); ok {
-			for _, item := range listInterface {
-				if str, ok := item.(string); ok {
-					imageList = append(imageList, str)
-				}
-			}
-		} else if listString, ok := existing.([]string); ok {
-			imageList = listString
-		}
-	}
-
-	if len(imageList) >= 8 {
-		b.sendMessage(chatID, b.Localizer.Get(lang, "upload_max_limit"))
+func (b *Bot) handleCallback(lg *slog.Logger, cb *models.CallbackQuery) {
+	// Callback dari inline message tidak membawa Message (hanya inline_message_id)
+	if cb.Message == nil {
+		b.answerCallback(cb.ID)
 		return
 	}
 
-	imageList = append(imageList, fileURL)
-	b.DB.UpdateDraftOption(userID, "image_input", imageList)
-	
-	msgText := fmt.Sprintf(b.Localizer.Get(lang, "upload_received"), len(imageList))
-	b.sendMessage(chatID, msgText)
-}
-
-func (b *Bot) handleCallback(cb *models.CallbackQuery) {
 	parts := strings.SplitN(cb.Data, ":", 3)
 	action := parts[0]
 	chatID := cb.Message.Chat.ID
 	messageID := cb.Message.MessageID
 	userID := cb.From.ID
-	lang := b.DB.GetUserLanguage(userID)
+	lang := b.userLang(userID)
 
-	http.Get(fmt.Sprintf("%s/answerCallbackQuery?callback_query_id=%s", b.APIURL, cb.ID))
+	b.answerCallback(cb.ID)
 
 	switch action {
+	case "bc":
+		b.handleBroadcastCallback(lg, chatID, messageID, userID, parts, lang)
+	case "buy":
+		b.handleBuyCallback(lg, chatID, parts, lang)
+	case "enh":
+		b.handleEnhanceCallback(lg, chatID, messageID, userID, parts, lang)
+	case "anim":
+		b.handleAnimate(lg, chatID, userID, cb.Message, parts, lang)
+	case "hist":
+		b.handleHistoryCallback(lg, chatID, messageID, userID, parts, lang)
 	case "back_to_start":
 		b.showMainMenu(chatID, messageID, true, lang)
 	case "lang":
 		if len(parts) > 1 {
 			newLang := parts[1]
-			b.DB.SetUserLanguage(userID, newLang)
+			if err := b.DB.SetUserLanguage(userID, newLang); err != nil {
+				b.storeFailed(lg, chatID, lang, err)
+				return
+			}
 			successMsg := b.Localizer.Get(newLang, "menu_lang_success")
 			b.editMessageWithKeyboard(chatID, messageID, successMsg, models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}})
 		}
@@ -211,22 +408,18 @@ func (b *Bot) handleCallback(cb *models.CallbackQuery) {
 	case "model":
 		if len(parts) > 1 {
 			modelID := parts[1]
-			b.DB.SetUserState(userID, "WAITING_PROMPT", modelID)
-			
-			b.DB.UpdateDraftOption(userID, "ratio", "1:1")
-			b.DB.UpdateDraftOption(userID, "format", "png")
-			b.DB.UpdateDraftOption(userID, "image_input", []string{}) 
-			
 			model := core.GetModelByID(modelID)
-			// Auto set ratio for Veo (Wajib 16:9 untuk best result)
-			if model != nil && strings.Contains(model.ID, "veo") {
-				b.DB.UpdateDraftOption(userID, "ratio", "16:9")
-			}
 
-			for _, op := range model.SupportedOps {
-				if op == "resolution" {
-					b.DB.UpdateDraftOption(userID, "resolution", "1K")
-				}
+			// Reset draft dalam satu transaksi, jadi tidak ada draft setengah jadi
+			err := b.DB.UpdateUserState(userID, func(state *database.UserState) error {
+				state.State = "WAITING_PROMPT"
+				state.SelectedModel = modelID
+				state.DraftOptions = newDraft(model)
+				return nil
+			})
+			if err != nil {
+				b.storeFailed(lg, chatID, lang, err)
+				return
 			}
 			b.showModelDashboard(chatID, messageID, userID, modelID, lang)
 		}
@@ -234,7 +427,10 @@ func (b *Bot) handleCallback(cb *models.CallbackQuery) {
 	case "dash":
 		if len(parts) > 1 {
 			modelID := parts[1]
-			b.DB.SetUserState(userID, "WAITING_PROMPT", modelID)
+			if err := b.DB.SetUserState(userID, "WAITING_PROMPT", modelID); err != nil {
+				b.storeFailed(lg, chatID, lang, err)
+				return
+			}
 			b.showModelDashboard(chatID, messageID, userID, modelID, lang)
 		}
 
@@ -242,34 +438,97 @@ func (b *Bot) handleCallback(cb *models.CallbackQuery) {
 		if len(parts) > 1 {
 			settingType := parts[1]
 			if settingType == "image_input" {
-				currentState := b.DB.GetUserState(userID)
-				b.DB.SetUserState(userID, "WAITING_IMAGE_UPLOAD", currentState.SelectedModel) 
-				
+				var currentState database.UserState
+				err := b.DB.UpdateUserState(userID, func(state *database.UserState) error {
+					state.State = "WAITING_IMAGE_UPLOAD"
+					currentState = *state
+					return nil
+				})
+				if err != nil {
+					b.storeFailed(lg, chatID, lang, err)
+					return
+				}
+
 				kb := models.InlineKeyboardMarkup{
 					InlineKeyboard: [][]models.InlineKeyboardButton{
 						{{Text: b.Localizer.Get(lang, "btn_done"), CallbackData: "upload_done"}},
 					},
 				}
-				b.editMessageWithKeyboard(chatID, messageID, b.Localizer.Get(lang, "upload_instruction"), kb)
+				maxImages := b.limitsFor(currentState.SelectedModel).MaxImages
+				b.editMessageWithKeyboard(chatID, messageID, fmt.Sprintf(b.Localizer.Get(lang, "upload_instruction"), maxImages), kb)
 			} else {
 				b.showSettingOptions(chatID, messageID, userID, settingType, lang)
 			}
 		}
 
 	case "upload_done":
-		state := b.DB.GetUserState(userID)
-		b.DB.SetUserState(userID, "WAITING_PROMPT", state.SelectedModel)
+		var state database.UserState
+		err := b.DB.UpdateUserState(userID, func(s *database.UserState) error {
+			s.State = "WAITING_PROMPT"
+			state = *s
+			return nil
+		})
+		if err != nil {
+			b.storeFailed(lg, chatID, lang, err)
+			return
+		}
 		b.showModelDashboard(chatID, messageID, userID, state.SelectedModel, lang)
 
 	case "opt":
 		if len(parts) > 2 {
 			settingType := parts[1]
 			value := parts[2]
-			b.DB.UpdateDraftOption(userID, settingType, value)
-			state := b.DB.GetUserState(userID)
+			err := b.DB.UpdateDraftOption(userID, settingType, value)
+			var state database.UserState
+			if err == nil {
+				state, err = b.DB.GetUserState(userID)
+			}
+			if err != nil {
+				b.storeFailed(lg, chatID, lang, err)
+				return
+			}
 			b.showModelDashboard(chatID, messageID, userID, state.SelectedModel, lang)
 		}
 
+	case "settings":
+		b.showSettings(chatID, messageID, true, userID, lang)
+
+	case "toggle_original":
+		enabled, err := b.DB.GetSendOriginal(userID)
+		if err == nil {
+			err = b.DB.SetSendOriginal(userID, !enabled)
+		}
+		if err != nil {
+			b.storeFailed(lg, chatID, lang, err)
+			return
+		}
+		b.showSettings(chatID, messageID, true, userID, lang)
+
+	case "toggle_enhance":
+		enabled, err := b.DB.GetEnhancePrompts(userID)
+		if err == nil {
+			err = b.DB.SetEnhancePrompts(userID, !enabled)
+		}
+		if err != nil {
+			b.storeFailed(lg, chatID, lang, err)
+			return
+		}
+		b.showSettings(chatID, messageID, true, userID, lang)
+
+	case "orig":
+		if len(parts) > 1 {
+			jobID, _ := strconv.ParseInt(parts[1], 10, 64)
+			job, err := b.DB.GetJob(jobID)
+			if err != nil && !errors.Is(err, database.ErrNotFound) {
+				lg.Error("failed to load job", "job_id", jobID, "err", err)
+			}
+			if err != nil || job.UserID != userID {
+				b.sendMessage(chatID, b.Localizer.Get(lang, "original_unavailable"))
+				return
+			}
+			b.sendOriginal(lg, chatID, job, lang)
+		}
+
 	case "back_home":
 		filterVideo := false
 		if len(parts) > 1 && parts[1] == "vids" {
@@ -278,17 +537,16 @@ func (b *Bot) handleCallback(cb *models.CallbackQuery) {
 		b.showProviders(chatID, messageID, true, lang, filterVideo)
 	
 	case "back_model":
-		state := b.DB.GetUserState(userID)
+		state, err := b.DB.GetUserState(userID)
+		if err != nil {
+			b.storeFailed(lg, chatID, lang, err)
+			return
+		}
 		model := core.GetModelByID(state.SelectedModel)
 		if model != nil {
 			provID := "google"
-			for _, p := range core.AI_REGISTRY {
-				for _, m := range p.Models {
-					if m.ID == model.ID {
-						provID = p.ID
-						break
-					}
-				}
+			if p := core.GetProviderForModel(model.ID); p != nil {
+				provID = p.ID
 			}
 			b.showModels(chatID, messageID, provID, lang)
 		} else {
@@ -299,7 +557,9 @@ func (b *Bot) handleCallback(cb *models.CallbackQuery) {
 
 func (b *Bot) handleCancel(chatID int64, userID int64, lang string) {
 	// 1. Reset Database State
-	b.DB.SetUserState(userID, "IDLE", "")
+	if err := b.DB.SetUserState(userID, "IDLE", ""); err != nil {
+		b.Log.Error("failed to reset user state", "user_id", userID, "err", err)
+	}
 	
 	// 2. Stop Background Process (Jika ada)
 	b.mu.Lock()
@@ -316,11 +576,16 @@ func (b *Bot) handleCancel(chatID int64, userID int64, lang string) {
 	}
 }
 
-func (b *Bot) getFileDirectURL(fileID string) (string, error) {
-	url := fmt.Sprintf("%s/getFile?file_id=%s", b.APIURL, fileID)
-	resp, err := http.Get(url)
+// getFilePath resolves a Telegram file_id into its file_path on Telegram's servers.
+func (b *Bot) getFilePath(fileID string) (string, error) {
+	resp, err := b.download.Get(fmt.Sprintf("%s/getFile?file_id=%s", b.APIURL, fileID))
 	if err != nil {
-		return "", err
+		// url.Error menyertakan URL yang berisi token bot; buang URL-nya.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", fmt.Errorf("getFile failed: %w", err)
 	}
 	defer resp.Body.Close()
 
@@ -333,9 +598,33 @@ func (b *Bot) getFileDirectURL(fileID string) (string, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return "", err
 	}
+	if !result.Ok || result.Result.FilePath == "" {
+		return "", fmt.Errorf("getFile failed for %s", fileID)
+	}
+	return result.Result.FilePath, nil
+}
+
+// rehostTelegramFile downloads a user upload from Telegram and re-uploads it to
+// Kie. The Telegram file URL contains the bot token, so it must never leave the
+// process or be stored; only the returned Kie URL is safe to persist.
+func (b *Bot) rehostTelegramFile(fileID string) (string, error) {
+	filePath, err := b.getFilePath(fileID)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := b.download.Get(b.fileURL + "/" + filePath)
+	if err != nil {
+		// Error dari net/http menyertakan URL (berisi token), jangan di-log mentah.
+		return "", fmt.Errorf("download telegram file failed")
+	}
+	defer resp.Body.Close()
 
-	fileURL := fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", b.Token, result.Result.FilePath)
-	return fileURL, nil
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("download telegram file status %d", resp.StatusCode)
+	}
+
+	return b.KieClient.UploadFile(resp.Body, path.Base(filePath))
 }
 
 // --- UI Functions ---
@@ -351,6 +640,7 @@ func (b *Bot) showMainMenu(chatID int64, messageID int64, isEdit bool, lang stri
 			{
 				// Tombol ganti bahasa
 				{Text: "🌐 Language / Bahasa", CallbackData: "lang:id"},
+				{Text: b.Localizer.Get(lang, "btn_settings"), CallbackData: "settings"},
 			},
 		},
 	}
@@ -364,6 +654,45 @@ func (b *Bot) showMainMenu(chatID int64, messageID int64, isEdit bool, lang stri
 	}
 }
 
+func (b *Bot) showSettings(chatID int64, messageID int64, isEdit bool, userID int64, lang string) {
+	enabled, err := b.DB.GetSendOriginal(userID)
+	if err != nil {
+		b.storeFailed(b.Log.With("user_id", userID), chatID, lang, err)
+		return
+	}
+	status := b.Localizer.Get(lang, "settings_off")
+	if enabled {
+		status = b.Localizer.Get(lang, "settings_on")
+	}
+
+	rows := [][]models.InlineKeyboardButton{
+		{{Text: fmt.Sprintf(b.Localizer.Get(lang, "btn_toggle_original"), status), CallbackData: "toggle_original"}},
+	}
+	text := b.Localizer.Get(lang, "settings_title")
+
+	// Tombol enhancer hanya muncul jika fiturnya dikonfigurasi.
+	if b.Enhancer != nil {
+		enhanceOn, err := b.DB.GetEnhancePrompts(userID)
+		if err != nil {
+			b.storeFailed(b.Log.With("user_id", userID), chatID, lang, err)
+			return
+		}
+		enhanceStatus := b.Localizer.Get(lang, "settings_off")
+		if enhanceOn {
+			enhanceStatus = b.Localizer.Get(lang, "settings_on")
+		}
+		rows = append(rows, []models.InlineKeyboardButton{{Text: fmt.Sprintf(b.Localizer.Get(lang, "btn_toggle_enhance"), enhanceStatus), CallbackData: "toggle_enhance"}})
+		text += b.Localizer.Get(lang, "settings_enhance")
+	}
+	rows = append(rows, []models.InlineKeyboardButton{{Text: b.Localizer.Get(lang, "btn_home"), CallbackData: "back_to_start"}})
+	kb := models.InlineKeyboardMarkup{InlineKeyboard: rows}
+	if isEdit {
+		b.editMessageWithKeyboard(chatID, messageID, text, kb)
+	} else {
+		b.sendMessageWithKeyboard(chatID, text, kb)
+	}
+}
+
 func (b *Bot) showLanguageMenu(chatID int64, messageID int64, isEdit bool, lang string) {
 	kb := models.InlineKeyboardMarkup{
 		InlineKeyboard: [][]models.InlineKeyboardButton{
@@ -433,13 +762,19 @@ func (b *Bot) showModels(chatID int64, messageID int64, providerID string, lang
 
 func (b *Bot) showModelDashboard(chatID int64, messageID int64, userID int64, modelID string, lang string) {
 	model := core.GetModelByID(modelID)
-	state := b.DB.GetUserState(userID)
+	state, err := b.DB.GetUserState(userID)
+	if err != nil {
+		b.storeFailed(b.Log.With("user_id", userID), chatID, lang, err)
+		return
+	}
 	opts := state.DraftOptions
 
 	text := fmt.Sprintf(b.Localizer.Get(lang, "dash_model"), model.Name)
 	text += fmt.Sprintf(b.Localizer.Get(lang, "dash_status"), b.Localizer.Get(lang, "dash_status_wait"))
 	text += b.Localizer.Get(lang, "dash_settings")
 	text += "<pre>"
+
+	limits := b.limitsFor(model.ID)
 	
 	for _, op := range model.SupportedOps {
 		val, exists := opts[op]
@@ -454,7 +789,7 @@ func (b *Bot) showModelDashboard(chatID int64, messageID int64, userID int64, mo
 			} else if list, ok := val.([]string); ok {
 				count = len(list)
 			}
-			text += fmt.Sprintf(b.Localizer.Get(lang, "dash_files_count"), count)
+			text += fmt.Sprintf(b.Localizer.Get(lang, "dash_files_count"), count, limits.MaxImages)
 		} else {
 			text += fmt.Sprintf("• %-10s : %v\n", strings.Title(op), val)
 		}
@@ -487,11 +822,20 @@ func (b *Bot) showModelDashboard(chatID int64, messageID int64, userID int64, mo
 	})
 
 	kb := models.InlineKeyboardMarkup{InlineKeyboard: rows}
+	// messageID 0: dashboard dikirim sebagai pesan baru
+	if messageID == 0 {
+		b.sendMessageWithKeyboard(chatID, text, kb)
+		return
+	}
 	b.editMessageWithKeyboard(chatID, messageID, text, kb)
 }
 
 func (b *Bot) showSettingOptions(chatID int64, messageID int64, userID int64, settingType string, lang string) {
-	state := b.DB.GetUserState(userID)
+	state, err := b.DB.GetUserState(userID)
+	if err != nil {
+		b.storeFailed(b.Log.With("user_id", userID), chatID, lang, err)
+		return
+	}
 	model := core.GetModelByID(state.SelectedModel)
 
 	var options []string
@@ -529,13 +873,53 @@ func (b *Bot) showSettingOptions(chatID int64, messageID int64, userID int64, se
 	b.editMessageWithKeyboard(chatID, messageID, text, kb)
 }
 
-func (b *Bot) processImageGeneration(chatID int64, userID int64, prompt string, state database.UserState, lang string) {
+// newDraft returns the draft options a freshly selected model starts with.
+// Options of the previously selected model are not carried over.
+func newDraft(model *core.AIModel) map[string]interface{} {
+	draft := map[string]interface{}{
+		"ratio":       "1:1",
+		"format":      "png",
+		"image_input": []string{},
+	}
+	if model == nil {
+		return draft
+	}
+	// Auto set ratio for Veo (Wajib 16:9 untuk best result)
+	if strings.Contains(model.ID, "veo") {
+		draft["ratio"] = "16:9"
+	}
+	if model.Supports("resolution") {
+		draft["resolution"] = "1K"
+	}
+	return draft
+}
+
+func (b *Bot) processImageGeneration(lg *slog.Logger, chatID int64, userID int64, prompt string, state database.UserState, lang string) {
+	// Moderasi dulu: prompt yang diblokir tidak memakai kuota atau kredit.
+	if ok, text := b.checkPrompt(lg, userID, prompt, lang); !ok {
+		b.sendMessage(chatID, text)
+		return
+	}
+	b.generate(lg, chatID, userID, prompt, state, lang)
+}
+
+// generate starts a job for a prompt that already passed checkPrompt.
+func (b *Bot) generate(lg *slog.Logger, chatID int64, userID int64, prompt string, state database.UserState, lang string) {
 	model := core.GetModelByID(state.SelectedModel)
 	if model == nil {
 		b.sendMessage(chatID, b.Localizer.Get(lang, "error_model_not_found"))
 		return
 	}
-	
+
+	// Cek kuota dan catat job sebelum handler selesai: update berikutnya dari
+	// chat ini baru diproses setelahnya, jadi job ini sudah ikut terhitung.
+	jobID, ok, text := b.startJob(lg, userID, chatID, model.ID, core.ModelType(model.ID), prompt, lang)
+	if !ok {
+		b.sendMessage(chatID, text)
+		return
+	}
+	lg = lg.With("job_id", jobID, "model", model.ID)
+
 	startMsg := fmt.Sprintf(b.Localizer.Get(lang, "gen_start"), model.Name) 
 	statusMsgResp, err := b.sendMessageReturnID(chatID, startMsg)
 	
@@ -545,12 +929,16 @@ func (b *Bot) processImageGeneration(chatID int64, userID int64, prompt string,
 	}
 
 	// --- CONTEXT MANAGEMENT FOR CANCEL ---
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(b.ctx)
 	b.mu.Lock()
 	b.activeTasks[userID] = cancel
 	b.mu.Unlock()
 	
+	b.jobs.Add(1)
 	go func() {
+		defer b.jobs.Done()
+		metrics.ActiveJobs.Inc()
+		defer metrics.ActiveJobs.Dec()
 		defer func() {
 			b.mu.Lock()
 			delete(b.activeTasks, userID)
@@ -559,287 +947,290 @@ func (b *Bot) processImageGeneration(chatID int64, userID int64, prompt string,
 
 		taskID, err := b.KieClient.CreateTaskComplex(prompt, model.APIModelID, state.DraftOptions)
 		if err != nil {
+			lg.Error("failed to create Kie task", "err", err)
+			b.finishJob(jobID, model.ID, "failed", "", "")
 			b.sendMessage(chatID, b.Localizer.Get(lang, "gen_fail_start"))
 			return
 		}
+		lg = lg.With("task_id", taskID)
+		lg.Info("job started")
+		if err := b.DB.SetJobTask(jobID, taskID); err != nil {
+			lg.Error("failed to record job task", "err", err)
+		}
 		
-		// FIX: Parameter jumlahnya 8 (termasuk ctx)
-		b.pollTaskResult(ctx, chatID, taskID, model.ID, lang, prompt, statusMsgID, state.DraftOptions)
+		b.pollTaskResult(ctx, lg, jobID, chatID, userID, taskID, model.ID, lang, prompt, statusMsgID, state.DraftOptions)
 	}()
 }
 
-// FIX: Menerima Context 'ctx'
-func (b *Bot) pollTaskResult(ctx context.Context, chatID int64, taskID string, modelID string, lang string, originalPrompt string, statusMsgID int64, options map[string]interface{}) {
-	ticker := time.NewTicker(3 * time.Second)
+// taskResult adalah hasil akhir dari satu task Kie (sukses atau gagal).
+type taskResult struct {
+	URLs    []string
+	FailMsg string
+}
+
+var errTaskTimeout = errors.New("task polling timed out")
+
+// waitForTask polls Kie until the task finishes, the context is canceled or the
+// timeout elapses. keepAlive is called right away and then every
+// chatActionInterval, independent of the poll interval (e.g. to keep a chat
+// action visible).
+func (b *Bot) waitForTask(ctx context.Context, lg *slog.Logger, taskID string, modelID string, keepAlive func()) (*taskResult, error) {
+	limits := b.limitsFor(modelID)
+	ticker := time.NewTicker(limits.PollInterval)
 	defer ticker.Stop()
-	timeout := time.After(5 * time.Minute)
-	
+	timeout := time.After(limits.Timeout)
+
+	var keepAliveC <-chan time.Time
+	if keepAlive != nil {
+		keepAlive()
+		t := time.NewTicker(chatActionInterval)
+		defer t.Stop()
+		keepAliveC = t.C
+	}
+
 	for {
 		select {
-		case <-ctx.Done(): // User Cancel
-			if statusMsgID != 0 {
-				b.deleteMessage(chatID, statusMsgID)
-			}
-			return
-
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		case <-timeout:
-			if statusMsgID != 0 {
-				b.deleteMessage(chatID, statusMsgID)
-			}
-			b.sendMessage(chatID, b.Localizer.Get(lang, "gen_timeout"))
-			return
+			return nil, errTaskTimeout
+		case <-keepAliveC:
+			keepAlive()
 		case <-ticker.C:
-			action := "upload_photo"
-			isVeo := strings.Contains(strings.ToLower(modelID), "veo")
-			if isVeo {
-				action = "upload_video"
-			}
-			b.sendChatAction(chatID, action)
+			metrics.PollIterationsTotal.Inc(modelID)
 
 			status, err := b.KieClient.GetTaskStatus(taskID, modelID)
 			if err != nil {
+				lg.Warn("task status poll failed", "err", err)
 				continue
 			}
-			
-			if status.Data.State == "success" {
+
+			switch status.Data.State {
+			case "success":
 				var res models.KieResultJSON
 				json.Unmarshal([]byte(status.Data.ResultJSON), &res)
-
-				if len(res.ResultURLs) > 0 {
-					resultURL := res.ResultURLs[0]
-					
-					if statusMsgID != 0 {
-						b.deleteMessage(chatID, statusMsgID)
-					}
-
-					displayPrompt := originalPrompt
-					if len(displayPrompt) > 300 {
-						displayPrompt = displayPrompt[:300] + "..."
-					}
-					
-					ratio := "1:1"
-					if r, ok := options["ratio"].(string); ok {
-						ratio = r
-					}
-					
-					modelName := "Unknown"
-					modelObj := core.GetModelByID(modelID)
-					if modelObj != nil {
-						modelName = modelObj.Name
-					}
-
-					caption := fmt.Sprintf(b.Localizer.Get(lang, "gen_caption"), modelName, ratio, displayPrompt)
-
-					if isVeo || strings.Contains(strings.ToLower(resultURL), ".mp4") {
-						b.sendVideo(chatID, resultURL, caption)
-					} else {
-						b.sendPhoto(chatID, resultURL, caption, lang)
-					}
-				} else {
-					if statusMsgID != 0 {
-						b.deleteMessage(chatID, statusMsgID)
-					}
-					b.sendMessage(chatID, b.Localizer.Get(lang, "gen_result_empty"))
-				}
-				return
-			} else if status.Data.State == "fail" {
-				if statusMsgID != 0 {
-					b.deleteMessage(chatID, statusMsgID)
-				}
-				failMsg := fmt.Sprintf(b.Localizer.Get(lang, "gen_fail"), status.Data.FailMsg)
-				b.sendMessage(chatID, failMsg)
-				return
+				return &taskResult{URLs: res.ResultURLs}, nil
+			case "fail":
+				return &taskResult{FailMsg: status.Data.FailMsg}, nil
 			}
 		}
 	}
 }
 
-func (b *Bot) sendVideo(chatID int64, videoURL, caption string) {
-	b.sendChatAction(chatID, "upload_video")
-	
-	resp, err := http.Get(videoURL)
-	if err != nil {
-		// Log Error Standar (Tanpa tag Debug)
-		log.Printf("Video Download Error: %v", err)
-		b.sendMessage(chatID, "❌ Gagal mendownload video dari server AI.")
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		log.Printf("Video Server Error: Status %d", resp.StatusCode)
-		b.sendMessage(chatID, "❌ Server AI menolak unduhan.")
-		return
+// FIX: Menerima Context 'ctx'
+func (b *Bot) pollTaskResult(ctx context.Context, lg *slog.Logger, jobID int64, chatID int64, userID int64, taskID string, modelID string, lang string, originalPrompt string, statusMsgID int64, options map[string]interface{}) {
+	isVeo := strings.Contains(strings.ToLower(modelID), "veo")
+	action := "upload_photo"
+	if isVeo {
+		action = "upload_video"
 	}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	result, err := b.waitForTask(ctx, lg, taskID, modelID, func() {
+		b.sendChatAction(chatID, action)
+	})
 
-	writer.WriteField("chat_id", fmt.Sprintf("%d", chatID))
-	writer.WriteField("caption", caption)
-	writer.WriteField("parse_mode", "HTML")
-	writer.WriteField("supports_streaming", "true") 
+	if statusMsgID != 0 {
+		b.deleteMessage(chatID, statusMsgID)
+	}
 
-	part, err := writer.CreateFormFile("video", "video.mp4")
 	if err != nil {
+		// User Cancel: cukup hapus status message
+		if err == errTaskTimeout {
+			lg.Warn("job timed out")
+			b.finishJob(jobID, modelID, "timeout", "", "")
+			b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "gen_timeout"), b.limitsFor(modelID).Timeout))
+		} else {
+			lg.Info("job canceled")
+			b.finishJob(jobID, modelID, "canceled", "", "")
+			// Dibatalkan karena bot berhenti, bukan oleh /cancel.
+			if b.ctx.Err() != nil {
+				b.sendMessage(chatID, b.Localizer.Get(lang, "gen_interrupted"))
+			}
+		}
 		return
 	}
 
-	_, err = io.Copy(part, resp.Body)
-	if err != nil {
+	if result.FailMsg != "" {
+		lg.Warn("job failed", "reason", result.FailMsg)
+		b.finishJob(jobID, modelID, "failed", "", "")
+		failMsg := fmt.Sprintf(b.Localizer.Get(lang, "gen_fail"), result.FailMsg)
+		b.sendMessage(chatID, failMsg)
 		return
 	}
-	writer.Close()
-
-	uploadURL := fmt.Sprintf("%s/sendVideo", b.APIURL)
-	
-	uploadReq, _ := http.NewRequest("POST", uploadURL, body)
-	uploadReq.Header.Set("Content-Type", writer.FormDataContentType())
 
-	client := &http.Client{Timeout: 120 * time.Second}
-	uploadResp, err := client.Do(uploadReq)
-	if err != nil {
-		log.Printf("Telegram Upload Error: %v", err)
-		// Fallback diam-diam tanpa log berisik
-		b.sendVideoByLink(chatID, videoURL, caption)
+	if len(result.URLs) == 0 {
+		lg.Warn("job returned no results")
+		b.finishJob(jobID, modelID, "failed", "", "")
+		b.sendMessage(chatID, b.Localizer.Get(lang, "gen_result_empty"))
 		return
 	}
-	defer uploadResp.Body.Close()
 
-	respBody, _ := io.ReadAll(uploadResp.Body)
-	
-	if uploadResp.StatusCode != 200 {
-		// Penting: Tetap log error body dari Telegram jika gagal
-		log.Printf("Telegram Rejected Video: %s", string(respBody))
-		b.sendVideoByLink(chatID, videoURL, caption)
+	resultURL := result.URLs[0]
+	src := b.cacheResult(lg, jobID, resultURL)
+	b.finishJob(jobID, modelID, "success", resultURL, src.Name)
+
+	caption := b.buildCaption(modelID, originalPrompt, options, lang)
+
+	method := b.deliverResult(lg, chatID, jobID, src, caption, lang, false)
+	lg.Info("job finished", "delivery", method.Method)
+
+	// Preferensi user: kirim juga file asli (tanpa kompresi) untuk hasil foto
+	if method != methodPhoto {
+		return
+	}
+	if enabled, err := b.DB.GetSendOriginal(userID); err != nil {
+		lg.Error("failed to read send-original setting", "err", err)
+	} else if enabled {
+		if job, err := b.DB.GetJob(jobID); err == nil {
+			b.sendOriginal(lg, chatID, job, lang)
+		} else {
+			lg.Error("failed to load job", "err", err)
+		}
 	}
 }
 
-func (b *Bot) sendVideoByLink(chatID int64, videoURL, caption string) {
-	reqBody := map[string]interface{}{
-		"chat_id":    chatID,
-		"video":      videoURL, 
-		"caption":    caption,
-		"parse_mode": "HTML",
+// finishJob mencatat status akhir job di database dan di metrics.
+func (b *Bot) finishJob(jobID int64, modelID string, status string, resultURL string, mediaName string) {
+	if err := b.DB.FinishJob(jobID, status, resultURL, mediaName); err != nil {
+		b.Log.Error("failed to record job result", "job_id", jobID, "status", status, "err", err)
 	}
-	
-	jsonData, _ := json.Marshal(reqBody)
-	resp, err := http.Post(fmt.Sprintf("%s/sendVideo", b.APIURL), "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("[VIDEO LINK ERROR] %v", err)
-		b.sendMessage(chatID, "❌ Gagal mengirim video (Network Error).")
-		return
+	metrics.JobsTotal.Inc(modelID, status)
+
+	if status == "success" {
+		b.rewardReferral(jobID)
 	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != 200 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		log.Printf("[VIDEO LINK FAIL] Telegram Response: %s", string(bodyBytes))
-		b.sendMessage(chatID, fmt.Sprintf("⚠️ Gagal memproses video.\n\nSilakan download manual: <a href=\"%s\">Klik Disini</a>", videoURL))
-	} else {
-		log.Println("[VIDEO] Berhasil dikirim via Link.")
+	// Job yang tidak menghasilkan apa-apa (gagal, timeout, dibatalkan) tidak
+	// dihitung ke kuota; kredit yang dipakai juga dikembalikan.
+	if status == "failed" || status == "timeout" || status == "canceled" {
+		returned, err := b.DB.ReverseCredits(database.CreditSpend, jobRef(jobID), database.CreditSpendReturn)
+		if err != nil {
+			b.Log.Error("failed to return job credits", "job_id", jobID, "err", err)
+		} else if returned {
+			b.Log.Info("job credits returned", "job_id", jobID)
+		}
 	}
 }
 
-func (b *Bot) sendPhoto(chatID int64, photoURL, caption, lang string) {
-	resp, err := http.Get(photoURL)
+// userLang returns the user's language, falling back to the configured
+// default for new users or when the lookup fails.
+func (b *Bot) userLang(userID int64) string {
+	lang, err := b.DB.GetUserLanguage(userID)
 	if err != nil {
-		log.Printf("Download failed: %v", err)
-		b.sendMessage(chatID, b.Localizer.Get(lang, "err_download"))
-		return
+		if !errors.Is(err, database.ErrNotFound) {
+			b.Log.Error("failed to read user language", "user_id", userID, "err", err)
+		}
+		return b.Cfg.DefaultLang
 	}
-	defer resp.Body.Close()
+	return lang
+}
 
-	if resp.StatusCode != 200 {
-		b.sendMessage(chatID, b.Localizer.Get(lang, "err_server"))
-		return
+// storeFailed mencatat error database dan memberi tahu user bahwa aksinya gagal.
+func (b *Bot) storeFailed(lg *slog.Logger, chatID int64, lang string, err error) {
+	lg.Error("database error", "err", err)
+	b.sendMessage(chatID, b.Localizer.Get(lang, "error_generic"))
+}
+
+// limitsFor menggabungkan batas per model dari models.json dengan default global dari config.
+func (b *Bot) limitsFor(modelID string) core.Limits {
+	def := core.Limits{
+		MaxImages:        b.Cfg.MaxImageInputs,
+		PollInterval:     b.Cfg.PollInterval,
+		Timeout:          b.Cfg.TaskTimeout,
+		CaptionPromptMax: b.Cfg.CaptionPromptMax,
+	}
+	if model := core.GetModelByID(modelID); model != nil {
+		return model.Limits(def)
 	}
+	return def
+}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	writer.WriteField("chat_id", fmt.Sprintf("%d", chatID))
-	writer.WriteField("caption", caption)
-	writer.WriteField("parse_mode", "HTML") 
-	
-	part, err := writer.CreateFormFile("photo", "image.png")
-	if err != nil {
-		return
+func (b *Bot) buildCaption(modelID string, originalPrompt string, options map[string]interface{}, lang string) string {
+	// Potong per rune agar karakter multi-byte tidak terbelah
+	displayPrompt := originalPrompt
+	maxLen := b.limitsFor(modelID).CaptionPromptMax
+	if runes := []rune(displayPrompt); len(runes) > maxLen {
+		displayPrompt = string(runes[:maxLen]) + "..."
 	}
-	io.Copy(part, resp.Body)
-	writer.Close()
 
-	uploadReq, err := http.NewRequest("POST", fmt.Sprintf("%s/sendPhoto", b.APIURL), body)
-	if err != nil {
-		return
+	ratio := "1:1"
+	if r, ok := options["ratio"].(string); ok {
+		ratio = r
 	}
-	uploadReq.Header.Set("Content-Type", writer.FormDataContentType())
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	uploadResp, err := client.Do(uploadReq)
-	if err != nil {
-		log.Printf("Upload to Telegram failed: %v", err)
-		b.sendMessage(chatID, b.Localizer.Get(lang, "err_send_tele"))
-		return
+	modelName := "Unknown"
+	modelObj := core.GetModelByID(modelID)
+	if modelObj != nil {
+		modelName = modelObj.Name
 	}
-	defer uploadResp.Body.Close()
+
+	return fmt.Sprintf(b.Localizer.Get(lang, "gen_caption"), modelName, ratio, displayPrompt)
 }
 
-func (b *Bot) sendChatAction(chatID int64, action string) {
+// sendChatAction mengirim status "typing/uploading". Action yang sama yang
+// baru saja dikirim ke chat ini dilewati, karena statusnya masih tampil.
+func (b *Bot) sendChatAction(chatID int64, action string) error {
+	if !b.out.shouldSendAction(chatID, action) {
+		return nil
+	}
 	req := models.SendChatActionRequest{ChatID: chatID, Action: action}
-	b.sendJSON("sendChatAction", req)
+	return b.sendJSON(chatID, "sendChatAction", req)
+}
+
+func (b *Bot) answerCallback(callbackID string) error {
+	return b.sendJSON(0, "answerCallbackQuery", map[string]string{"callback_query_id": callbackID})
 }
 
-func (b *Bot) deleteMessage(chatID int64, messageID int64) {
+func (b *Bot) deleteMessage(chatID int64, messageID int64) error {
 	req := models.DeleteMessageRequest{ChatID: chatID, MessageID: messageID}
-	b.sendJSON("deleteMessage", req)
+	return b.sendJSON(chatID, "deleteMessage", req)
 }
 
-func (b *Bot) sendMessage(chatID int64, text string) {
-	b.sendJSON("sendMessage", models.SendMessageRequest{
+func (b *Bot) sendMessage(chatID int64, text string) error {
+	return b.sendJSON(chatID, "sendMessage", models.SendMessageRequest{
 		ChatID: chatID, Text: text, ParseMode: "HTML",
 	})
 }
 
 func (b *Bot) sendMessageReturnID(chatID int64, text string) (int64, error) {
-	jsonData, _ := json.Marshal(models.SendMessageRequest{
+	raw, err := b.out.Call("sendMessage", chatID, models.SendMessageRequest{
 		ChatID: chatID, Text: text, ParseMode: "HTML",
 	})
-	resp, err := http.Post(fmt.Sprintf("%s/sendMessage", b.APIURL), "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return 0, err
 	}
-	defer resp.Body.Close()
-	
-	var result struct {
-		Ok     bool                    `json:"ok"`
-		Result *models.TelegramMessage `json:"result"`
-	}
-	json.NewDecoder(resp.Body).Decode(&result)
-	
-	if result.Result != nil {
-		return result.Result.MessageID, nil
+
+	var msg models.TelegramMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return 0, err
 	}
-	return 0, fmt.Errorf("failed to send")
+	return msg.MessageID, nil
 }
 
-func (b *Bot) sendMessageWithKeyboard(chatID int64, text string, kb models.InlineKeyboardMarkup) {
-	b.sendJSON("sendMessage", models.SendMessageRequest{
+func (b *Bot) sendMessageWithKeyboard(chatID int64, text string, kb models.InlineKeyboardMarkup) error {
+	return b.sendJSON(chatID, "sendMessage", models.SendMessageRequest{
 		ChatID: chatID, Text: text, ReplyMarkup: kb, ParseMode: "HTML",
 	})
 }
 
-func (b *Bot) editMessageWithKeyboard(chatID int64, messageID int64, text string, kb models.InlineKeyboardMarkup) {
-	b.sendJSON("editMessageText", models.EditMessageTextRequest{
+func (b *Bot) editMessageWithKeyboard(chatID int64, messageID int64, text string, kb models.InlineKeyboardMarkup) error {
+	return b.sendJSON(chatID, "editMessageText", models.EditMessageTextRequest{
 		ChatID: chatID, MessageID: messageID, Text: text, ReplyMarkup: kb, ParseMode: "HTML",
 	})
 }
 
-func (b *Bot) sendJSON(method string, data interface{}) {
-	jsonData, _ := json.Marshal(data)
-	resp, err := http.Post(fmt.Sprintf("%s/%s", b.APIURL, method), "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("Network error: %v", err)
-		return
+// sendJSON mengirim request lewat sender dan mencatat kegagalannya. chatID
+// dipakai untuk rate limit per chat; isi 0 untuk request yang tidak terikat chat.
+func (b *Bot) sendJSON(chatID int64, method string, data interface{}) error {
+	_, err := b.out.Call(method, chatID, data)
+	if err == nil || isNotModified(err) {
+		return nil
 	}
-	defer resp.Body.Close()
+	b.Log.Warn("Telegram request failed", "method", method, "chat_id", chatID, "err", err)
+	return err
+}
+
+// isNotModified: edit dengan isi yang sama ditolak Telegram, tapi bukan masalah.
+func isNotModified(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && strings.Contains(apiErr.Description, "message is not modified")
 }
\ No newline at end of file
@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kieAITelegram/internal/api"
+	"kieAITelegram/internal/config"
+	"kieAITelegram/internal/core"
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/i18n"
+	"kieAITelegram/internal/models"
+)
+
+// apiCall adalah satu request yang diterima fakeTelegram. Untuk upload
+// multipart, Body berisi field teksnya.
+type apiCall struct {
+	Method string
+	Body   map[string]interface{}
+}
+
+// fakeTelegram adalah Bot API palsu: semua method sukses, dan pesan yang
+// dikirim mendapat message_id berurutan. Request ke Kie juga diarahkan ke
+// sini dan selalu ditolak, jadi job yang dimulai langsung gagal.
+type fakeTelegram struct {
+	mu     sync.Mutex
+	calls  []apiCall
+	nextID int64
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := apiCall{Method: path.Base(r.URL.Path)}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &call.Body)
+	} else if err := r.ParseMultipartForm(32 << 20); err == nil {
+		call.Body = map[string]interface{}{}
+		for key, values := range r.MultipartForm.Value {
+			call.Body[key] = values[0]
+		}
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/kie") {
+		fmt.Fprint(w, `{"code":500,"msg":"fake Kie"}`)
+		return
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, call)
+	f.nextID++
+	id := f.nextID
+	f.mu.Unlock()
+
+	fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, id)
+}
+
+// Calls mengembalikan request ke method, urut sesuai kedatangan.
+func (f *fakeTelegram) Calls(method string) []apiCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []apiCall
+	for _, c := range f.calls {
+		if c.Method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Last mengembalikan request terakhir ke method.
+func (f *fakeTelegram) Last(t *testing.T, method string) apiCall {
+	t.Helper()
+	calls := f.Calls(method)
+	if len(calls) == 0 {
+		t.Fatalf("no %s request", method)
+	}
+	return calls[len(calls)-1]
+}
+
+var loadRegistry sync.Once
+
+// newTestBot membuat Bot dengan database SQLite sementara dan Bot API palsu.
+func newTestBot(t *testing.T) (*Bot, *fakeTelegram) {
+	t.Helper()
+	loadRegistry.Do(func() {
+		if err := core.LoadRegistry("../../models.json"); err != nil {
+			t.Fatalf("load models: %v", err)
+		}
+	})
+
+	tg := &fakeTelegram{}
+	srv := httptest.NewServer(tg)
+	t.Cleanup(srv.Close)
+
+	db, err := database.Open(database.DriverSQLite, filepath.Join(t.TempDir(), "bot.db"), true)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := config.Defaults()
+	cfg.TelegramToken = "1:test"
+	cfg.TelegramAPIURL = srv.URL
+	kie := api.NewKieClient("test", time.Second)
+	kie.BaseURL = srv.URL + "/kie"
+	kie.UploadBaseURL = srv.URL + "/kie-upload"
+	b := NewBot(cfg, db, kie, i18n.NewLocalizer("../../locales", "en"))
+	b.Log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	t.Cleanup(func() {
+		b.Stop()
+		b.jobs.Wait()
+	})
+	return b, tg
+}
+
+func privateMessage(userID int64, text string) *models.TelegramMessage {
+	return &models.TelegramMessage{
+		Chat: &models.Chat{ID: userID},
+		From: &models.User{ID: userID},
+		Text: text,
+	}
+}
@@ -0,0 +1,358 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/models"
+)
+
+// Status broadcast di database.
+const (
+	broadcastDraft    = "draft"
+	broadcastRunning  = "running"
+	broadcastDone     = "done"
+	broadcastStopped  = "stopped"
+	broadcastCanceled = "canceled"
+)
+
+const (
+	// Broadcast memakai sebagian dari batas global Telegram supaya balasan
+	// ke user lain tetap lancar selama pengiriman berjalan.
+	broadcastRate = 20
+	// Jumlah penerima yang diambil dari database per halaman.
+	broadcastPageSize = 100
+	// Progres disimpan dan pesan admin di-update paling cepat tiap interval ini.
+	broadcastProgressEvery = 5 * time.Second
+)
+
+// Baris "[Teks](https://...)" di akhir pesan menjadi tombol URL.
+var broadcastButtonRe = regexp.MustCompile(`^\[([^\]]+)\]\((https?://\S+)\)$`)
+
+// parseBroadcast membaca perintah admin:
+//
+//	/broadcast lang=id active=30
+//	Teks pengumuman (HTML)...
+//	[Coba sekarang](https://t.me/bot)
+//
+// Opsi di baris pertama boleh dikosongkan. Tombol hanya dikenali pada baris
+// setelah teks.
+func parseBroadcast(text string) (msg string, buttons []database.BroadcastButton, seg database.Segment, err error) {
+	header, body, _ := strings.Cut(text, "\n")
+	for _, opt := range strings.Fields(header)[1:] {
+		key, val, ok := strings.Cut(opt, "=")
+		switch {
+		case ok && key == "lang" && val != "":
+			seg.Lang = val
+		case ok && key == "active":
+			days, convErr := strconv.Atoi(strings.TrimSuffix(val, "d"))
+			if convErr != nil || days < 1 {
+				return "", nil, seg, fmt.Errorf("active must be a number of days, got %q", val)
+			}
+			seg.ActiveDays = days
+		default:
+			return "", nil, seg, fmt.Errorf("unknown option %q", opt)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	for len(lines) > 0 {
+		m := broadcastButtonRe.FindStringSubmatch(strings.TrimSpace(lines[len(lines)-1]))
+		if m == nil {
+			break
+		}
+		buttons = append([]database.BroadcastButton{{Text: m[1], URL: m[2]}}, buttons...)
+		lines = lines[:len(lines)-1]
+	}
+
+	msg = strings.TrimSpace(strings.Join(lines, "\n"))
+	if msg == "" {
+		return "", nil, seg, errors.New("message text is empty")
+	}
+	return msg, buttons, seg, nil
+}
+
+func broadcastKeyboard(buttons []database.BroadcastButton) interface{} {
+	if len(buttons) == 0 {
+		return nil
+	}
+	kb := models.InlineKeyboardMarkup{}
+	for _, btn := range buttons {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{{Text: btn.Text, URL: btn.URL}})
+	}
+	return kb
+}
+
+// recipientSegment melengkapi segmen: user yang belum memilih bahasa memakai
+// bahasa default, jadi mereka ikut saat broadcast ke bahasa default.
+func (b *Bot) recipientSegment(seg database.Segment) database.Segment {
+	seg.IncludeUnsetLang = seg.Lang == b.Cfg.DefaultLang
+	return seg
+}
+
+func describeSegment(seg database.Segment) string {
+	var parts []string
+	if seg.Lang != "" {
+		parts = append(parts, "lang="+seg.Lang)
+	}
+	if seg.ActiveDays > 0 {
+		parts = append(parts, fmt.Sprintf("active=%dd", seg.ActiveDays))
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// handleBroadcastCommand membuat draft broadcast dan mengirim preview ke admin.
+// Pengiriman baru dimulai setelah admin menekan tombol kirim.
+func (b *Bot) handleBroadcastCommand(lg *slog.Logger, chatID int64, userID int64, text string, lang string) {
+	msg, buttons, seg, err := parseBroadcast(text)
+	if err != nil {
+		b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "broadcast_usage"), err.Error()))
+		return
+	}
+
+	// Preview persis seperti yang akan diterima user; HTML yang tidak valid
+	// langsung ketahuan di sini.
+	err = b.sendJSON(chatID, "sendMessage", models.SendMessageRequest{
+		ChatID: chatID, Text: msg, ParseMode: "HTML", ReplyMarkup: broadcastKeyboard(buttons),
+	})
+	if err != nil {
+		b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "broadcast_preview_failed"), err.Error()))
+		return
+	}
+
+	total, err := b.DB.CountRecipients(b.recipientSegment(seg))
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	bc := &database.Broadcast{
+		AdminID: userID,
+		ChatID:  chatID,
+		Text:    msg,
+		Buttons: buttons,
+		Segment: seg,
+		Status:  broadcastDraft,
+		Total:   total,
+	}
+	id, err := b.DB.CreateBroadcast(bc)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+
+	kb := models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{
+			{
+				{Text: b.Localizer.Get(lang, "btn_broadcast_send"), CallbackData: fmt.Sprintf("bc:send:%d", id)},
+				{Text: b.Localizer.Get(lang, "btn_broadcast_cancel"), CallbackData: fmt.Sprintf("bc:cancel:%d", id)},
+			},
+		},
+	}
+	b.sendMessageWithKeyboard(chatID, fmt.Sprintf(b.Localizer.Get(lang, "broadcast_confirm"), total, describeSegment(seg)), kb)
+}
+
+// handleBroadcastCallback menangani tombol bc:<aksi>:<id> di pesan konfirmasi/progres.
+func (b *Bot) handleBroadcastCallback(lg *slog.Logger, chatID int64, messageID int64, userID int64, parts []string, lang string) {
+	if !b.Cfg.IsAdmin(userID) || len(parts) < 3 {
+		return
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return
+	}
+	lg = lg.With("broadcast_id", id)
+
+	var from, to string
+	switch parts[1] {
+	case "send":
+		from, to = broadcastDraft, broadcastRunning
+	case "cancel":
+		from, to = broadcastDraft, broadcastCanceled
+	case "stop":
+		from, to = broadcastRunning, broadcastStopped
+	default:
+		return
+	}
+
+	// Compare-and-set: klik ganda atau tombol lama tidak memulai pengiriman dua kali.
+	changed, err := b.DB.SetBroadcastStatus(id, from, to)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	switch to {
+	case broadcastCanceled:
+		b.editMessageWithKeyboard(chatID, messageID, b.Localizer.Get(lang, "broadcast_canceled"), models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}})
+	case broadcastRunning:
+		bc, err := b.DB.GetBroadcast(id)
+		if err != nil {
+			b.storeFailed(lg, chatID, lang, err)
+			return
+		}
+		bc.MessageID = messageID
+		lg.Info("broadcast started", "total", bc.Total, "segment", describeSegment(bc.Segment))
+		b.startBroadcast(lg, bc)
+	}
+	// Untuk stop, runBroadcast sendiri yang memperbarui pesan progres.
+}
+
+// resumeBroadcasts melanjutkan broadcast yang masih berjalan saat bot berhenti.
+func (b *Bot) resumeBroadcasts() {
+	list, err := b.DB.ListBroadcasts(broadcastRunning)
+	if err != nil {
+		b.Log.Error("failed to load running broadcasts", "err", err)
+		return
+	}
+	for i := range list {
+		bc := &list[i]
+		lg := b.Log.With("broadcast_id", bc.ID)
+		lg.Info("resuming broadcast", "sent", bc.Sent, "total", bc.Total)
+		b.startBroadcast(lg, bc)
+	}
+}
+
+// startBroadcast menjalankan runBroadcast di background. Goroutine-nya
+// dihitung di b.jobs, jadi Start menunggunya selesai sebelum bot berhenti.
+func (b *Bot) startBroadcast(lg *slog.Logger, bc *database.Broadcast) {
+	b.jobs.Add(1)
+	go func() {
+		defer b.jobs.Done()
+		b.runBroadcast(lg, bc)
+	}()
+}
+
+// runBroadcast mengirim broadcast ke semua penerima yang belum diproses.
+// Progres disimpan berkala, jadi setelah restart pengiriman dilanjutkan dari
+// user terakhir yang tersimpan (paling banyak beberapa user menerima dua kali).
+// Saat bot berhenti, broadcast tetap berstatus running dan progresnya disimpan.
+func (b *Bot) runBroadcast(lg *slog.Logger, bc *database.Broadcast) {
+	// Progres selalu disimpan saat keluar, apa pun alasannya.
+	defer b.saveBroadcast(lg, bc)
+	lang := b.userLang(bc.AdminID)
+	seg := b.recipientSegment(bc.Segment)
+	limiter := newTokenBucket(broadcastRate, broadcastRate)
+	req := models.SendMessageRequest{Text: bc.Text, ParseMode: "HTML", ReplyMarkup: broadcastKeyboard(bc.Buttons)}
+
+	b.showBroadcastProgress(lg, bc, lang)
+	lastSave := time.Now()
+	for {
+		ids, err := b.DB.ListRecipients(seg, bc.LastUserID, broadcastPageSize)
+		if err != nil {
+			// Tetap berstatus running: dilanjutkan saat restart berikutnya.
+			lg.Error("failed to load broadcast recipients", "err", err)
+			return
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		current, err := b.DB.GetBroadcast(bc.ID)
+		if err != nil {
+			lg.Error("failed to reload broadcast", "err", err)
+			return
+		}
+		if current.Status != broadcastRunning {
+			bc.Status = current.Status
+			lg.Info("broadcast stopped", "sent", bc.Sent)
+			b.showBroadcastProgress(lg, bc, lang)
+			return
+		}
+
+		for _, userID := range ids {
+			if b.ctx.Err() != nil || limiter.wait(b.ctx) != nil {
+				lg.Info("broadcast paused by shutdown", "sent", bc.Sent)
+				return
+			}
+			req.ChatID = userID
+			_, err := b.out.Call("sendMessage", userID, req)
+
+			var apiErr *APIError
+			switch {
+			case err == nil:
+				bc.Sent++
+			case errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden:
+				// User memblokir bot atau akunnya dihapus
+				bc.Blocked++
+				if err := b.DB.SetUserBlocked(userID); err != nil {
+					lg.Warn("failed to mark user blocked", "user_id", userID, "err", err)
+				}
+			default:
+				bc.Failed++
+				lg.Warn("broadcast delivery failed", "user_id", userID, "err", err)
+			}
+			bc.LastUserID = userID
+
+			if time.Since(lastSave) >= broadcastProgressEvery {
+				b.saveBroadcast(lg, bc)
+				b.showBroadcastProgress(lg, bc, lang)
+				lastSave = time.Now()
+			}
+		}
+	}
+
+	if _, err := b.DB.SetBroadcastStatus(bc.ID, broadcastRunning, broadcastDone); err != nil {
+		lg.Error("failed to finish broadcast", "err", err)
+	}
+	bc.Status = broadcastDone
+	b.showBroadcastProgress(lg, bc, lang)
+	lg.Info("broadcast finished", "sent", bc.Sent, "failed", bc.Failed, "blocked", bc.Blocked)
+}
+
+func (b *Bot) saveBroadcast(lg *slog.Logger, bc *database.Broadcast) {
+	if err := b.DB.SaveBroadcastProgress(bc); err != nil {
+		lg.Error("failed to save broadcast progress", "err", err)
+	}
+}
+
+// showBroadcastProgress meng-update pesan progres di chat admin. Selama
+// berjalan ada tombol stop.
+func (b *Bot) showBroadcastProgress(lg *slog.Logger, bc *database.Broadcast, lang string) {
+	processed := bc.Sent + bc.Failed + bc.Blocked
+	total := bc.Total
+	if processed > total {
+		total = processed
+	}
+	text := fmt.Sprintf(b.Localizer.Get(lang, "broadcast_progress"),
+		bc.ID, b.Localizer.Get(lang, "broadcast_status_"+bc.Status), processed, total, bc.Sent, bc.Failed, bc.Blocked)
+
+	kb := models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}}
+	if bc.Status == broadcastRunning {
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{
+			{Text: b.Localizer.Get(lang, "btn_broadcast_stop"), CallbackData: fmt.Sprintf("bc:stop:%d", bc.ID)},
+		})
+	}
+
+	if bc.MessageID != 0 {
+		if b.editMessageWithKeyboard(bc.ChatID, bc.MessageID, text, kb) == nil {
+			return
+		}
+	}
+	// Pesan lama tidak bisa diedit (misal sudah dihapus): kirim pesan baru.
+	raw, err := b.out.Call("sendMessage", bc.ChatID, models.SendMessageRequest{
+		ChatID: bc.ChatID, Text: text, ReplyMarkup: kb, ParseMode: "HTML",
+	})
+	var sent models.TelegramMessage
+	if err == nil {
+		err = json.Unmarshal(raw, &sent)
+	}
+	if err != nil {
+		lg.Warn("failed to show broadcast progress", "err", err)
+		return
+	}
+	bc.MessageID = sent.MessageID
+}
@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"testing"
+
+	"kieAITelegram/internal/database"
+)
+
+// newRunningBroadcast menyimpan broadcast berstatus running untuk user 11-13.
+func newRunningBroadcast(t *testing.T, b *Bot) int64 {
+	t.Helper()
+	for _, userID := range []int64{11, 12, 13} {
+		if err := b.DB.TouchUser(userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id, err := b.DB.CreateBroadcast(&database.Broadcast{
+		AdminID: 9, ChatID: 9, MessageID: 1, Text: "hello", Status: broadcastRunning, Total: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// broadcastRecipients mengembalikan chat_id semua sendMessage yang terkirim.
+func broadcastRecipients(tg *fakeTelegram) []int64 {
+	var ids []int64
+	for _, c := range tg.Calls("sendMessage") {
+		ids = append(ids, int64(c.Body["chat_id"].(float64)))
+	}
+	return ids
+}
+
+func TestBroadcastResumesAndFinishes(t *testing.T) {
+	b, tg := newTestBot(t)
+	id := newRunningBroadcast(t, b)
+
+	b.resumeBroadcasts()
+	b.jobs.Wait()
+
+	bc, err := b.DB.GetBroadcast(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.Status != broadcastDone || bc.Sent != 3 || bc.LastUserID != 13 {
+		t.Fatalf("broadcast = %+v, want done with 3 sent", bc)
+	}
+	if got := broadcastRecipients(tg); len(got) != 3 {
+		t.Fatalf("sent to %v, want users 11-13", got)
+	}
+}
+
+func TestBroadcastPausedByShutdown(t *testing.T) {
+	b, tg := newTestBot(t)
+	id := newRunningBroadcast(t, b)
+
+	b.Stop()
+	b.resumeBroadcasts()
+	b.jobs.Wait()
+
+	bc, err := b.DB.GetBroadcast(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tetap running supaya dilanjutkan setelah restart.
+	if bc.Status != broadcastRunning || bc.Sent != 0 || bc.LastUserID != 0 {
+		t.Fatalf("broadcast = %+v, want running with nothing sent", bc)
+	}
+	if got := broadcastRecipients(tg); len(got) != 0 {
+		t.Fatalf("sent to %v after shutdown", got)
+	}
+}
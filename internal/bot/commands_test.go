@@ -0,0 +1,37 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"kieAITelegram/internal/models"
+)
+
+// Di grup, Telegram mengirim perintah dengan akhiran @namabot.
+func TestCommandsWithBotSuffix(t *testing.T) {
+	cases := []struct {
+		text string
+		key  string
+	}{
+		{"/invite@kiebot", "invite_text"},
+		{"/buy@kiebot", "buy_title"},
+		{"/quota@kiebot", "quota_title"},
+		{"/cancel@kiebot", "cancel_success"},
+	}
+	for _, c := range cases {
+		t.Run(c.text, func(t *testing.T) {
+			b, tg := newTestBot(t)
+			b.username = "kiebot"
+			b.Cfg.CreditPackages = []models.CreditPackage{{Credits: 50, Stars: 25}}
+
+			b.handleMessage(b.Log, privateMessage(400, c.text))
+
+			// Bandingkan bagian teks sebelum placeholder pertama.
+			want, _, _ := strings.Cut(b.Localizer.Get("en", c.key), "%")
+			text, _ := tg.Last(t, "sendMessage").Body["text"].(string)
+			if !strings.HasPrefix(text, want) {
+				t.Fatalf("reply = %q, want %s", text, c.key)
+			}
+		})
+	}
+}
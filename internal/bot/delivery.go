@@ -0,0 +1,400 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/metrics"
+	"kieAITelegram/internal/models"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Batas upload multipart Bot API.
+const (
+	maxPhotoUploadBytes = 10 * 1024 * 1024
+	maxFileUploadBytes  = 50 * 1024 * 1024
+)
+
+var (
+	errUpstreamStatus = errors.New("result server returned an error status")
+	errFileTooLarge   = errors.New("file exceeds Telegram upload limit")
+)
+
+// resultSource menunjuk ke file hasil generate: URL sementara dari Kie dan,
+// jika media server aktif, nama file cache lokalnya.
+type resultSource struct {
+	URL  string
+	Name string
+}
+
+// cacheResult downloads a result into the media store so later deliveries,
+// fallbacks and history don't depend on Kie's expiring URL. Without a media
+// store (or when caching fails) the source just points at the upstream URL.
+func (b *Bot) cacheResult(lg *slog.Logger, jobID int64, resultURL string) resultSource {
+	src := resultSource{URL: resultURL}
+	if b.Media == nil {
+		return src
+	}
+
+	resp, err := b.download.Get(resultURL)
+	if err != nil {
+		lg.Warn("result cache download failed", "err", err)
+		return src
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		lg.Warn("result cache download failed", "status", resp.StatusCode)
+		return src
+	}
+
+	name := fmt.Sprintf("job-%d%s", jobID, resultExt(resultURL))
+	if _, err := b.Media.Save(name, resp.Body); err != nil {
+		lg.Error("result cache save failed", "err", err)
+		return src
+	}
+
+	src.Name = name
+	return src
+}
+
+// resultFile adalah file hasil yang sudah dibuka, dengan tipe konten hasil sniffing.
+type resultFile struct {
+	io.Reader
+	io.Closer
+	Size        int64
+	ContentType string
+}
+
+// openResult membuka file hasil, dari cache lokal jika ada atau dari Kie.
+// Size bernilai -1 jika ukuran tidak diketahui.
+func (b *Bot) openResult(lg *slog.Logger, src resultSource) (*resultFile, error) {
+	if src.Name != "" && b.Media != nil {
+		if f, err := b.Media.Open(src.Name); err == nil {
+			size := int64(-1)
+			if info, err := f.Stat(); err == nil {
+				size = info.Size()
+			}
+			return sniffResult(f, size, "", src.URL), nil
+		}
+	}
+
+	resp, err := b.download.Get(src.URL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		lg.Warn("result server error", "status", resp.StatusCode)
+		return nil, errUpstreamStatus
+	}
+	return sniffResult(resp.Body, resp.ContentLength, resp.Header.Get("Content-Type"), src.URL), nil
+}
+
+// sniffResult determines the content type from the first bytes of the file,
+// falling back to the response header and then to the URL extension when the
+// bytes are not conclusive.
+func sniffResult(rc io.ReadCloser, size int64, headerType string, resultURL string) *resultFile {
+	br := bufio.NewReaderSize(rc, 512)
+	head, _ := br.Peek(512)
+
+	contentType := http.DetectContentType(head)
+	if contentType == "application/octet-stream" || strings.HasPrefix(contentType, "text/plain") {
+		if mt, _, err := mime.ParseMediaType(headerType); err == nil && mt != "application/octet-stream" {
+			contentType = mt
+		} else if byExt := mime.TypeByExtension(resultExt(resultURL)); byExt != "" {
+			contentType = byExt
+		}
+	}
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mt
+	}
+
+	return &resultFile{Reader: br, Closer: rc, Size: size, ContentType: contentType}
+}
+
+// resultLink returns the most durable public link for a result: a signed
+// media-server link when cached, otherwise Kie's temporary URL.
+func (b *Bot) resultLink(src resultSource) string {
+	if src.Name != "" && b.Media != nil && b.Media.Exists(src.Name) {
+		return b.Media.SignedURL(src.Name)
+	}
+	return src.URL
+}
+
+func resultExt(resultURL string) string {
+	u, err := url.Parse(resultURL)
+	if err != nil {
+		return ""
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	if len(ext) > 5 {
+		return ""
+	}
+	return ext
+}
+
+// uploadFile streams r to a Bot API method as multipart/form-data through an
+// io.Pipe, so the file is never held in memory as a whole. Uploads larger than
+// limit are aborted with errFileTooLarge. The upload waits for chatID's rate
+// limit; a 429 is returned as *APIError rather than retried.
+func (b *Bot) uploadFile(chatID int64, method string, fields map[string]string, fileField string, fileName string, r io.Reader, limit int64, timeout time.Duration) (*models.TelegramMessage, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		for key, val := range fields {
+			writer.WriteField(key, val)
+		}
+
+		part, err := writer.CreateFormFile(fileField, fileName)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		n, err := io.Copy(part, io.LimitReader(r, limit+1))
+		if err == nil && n > limit {
+			err = errFileTooLarge
+		}
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	raw, err := b.out.Upload(method, chatID, writer.FormDataContentType(), pr, timeout)
+	// Pastikan goroutine penulis berhenti jika request gagal sebelum body habis dibaca.
+	pr.Close()
+	if err != nil {
+		if errors.Is(err, errFileTooLarge) {
+			return nil, errFileTooLarge
+		}
+		return nil, err
+	}
+
+	var msg models.TelegramMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// uploadMethod menjelaskan cara mengirim satu jenis file lewat Bot API.
+type uploadMethod struct {
+	Method string
+	Field  string
+	Action string
+	Limit  int64
+}
+
+var (
+	methodPhoto     = uploadMethod{"sendPhoto", "photo", "upload_photo", maxPhotoUploadBytes}
+	methodVideo     = uploadMethod{"sendVideo", "video", "upload_video", maxFileUploadBytes}
+	methodAnimation = uploadMethod{"sendAnimation", "animation", "upload_video", maxFileUploadBytes}
+	methodDocument  = uploadMethod{"sendDocument", "document", "upload_document", maxFileUploadBytes}
+)
+
+var extByContentType = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"image/gif":       ".gif",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"video/quicktime": ".mov",
+}
+
+func methodForContentType(contentType string) uploadMethod {
+	switch {
+	case contentType == "image/gif":
+		return methodAnimation
+	case contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/webp":
+		return methodPhoto
+	case strings.HasPrefix(contentType, "video/"):
+		return methodVideo
+	}
+	return methodDocument
+}
+
+// resultFileName menamai file berdasarkan job dan formatnya, misal "kie-42.jpg".
+func resultFileName(jobID int64, contentType string, resultURL string) string {
+	ext, ok := extByContentType[contentType]
+	if !ok {
+		ext = resultExt(resultURL)
+	}
+	if ext == "" {
+		ext = ".bin"
+	}
+	return fmt.Sprintf("kie-%d%s", jobID, ext)
+}
+
+// deliverResult sends a finished result with the Bot API method matching its
+// real content type. asDocument forces sendDocument so images are delivered
+// without Telegram's recompression. It returns the method that was used for a
+// successful upload, or the zero uploadMethod when the result was not uploaded.
+func (b *Bot) deliverResult(lg *slog.Logger, chatID int64, jobID int64, src resultSource, caption string, lang string, asDocument bool) uploadMethod {
+	file, err := b.openResult(lg, src)
+	if err != nil {
+		if err == errUpstreamStatus {
+			b.sendMessage(chatID, b.Localizer.Get(lang, "err_server"))
+			return uploadMethod{}
+		}
+		lg.Error("result download failed", "err", err)
+		b.sendMessage(chatID, b.Localizer.Get(lang, "err_download"))
+		return uploadMethod{}
+	}
+	return b.deliverFile(lg, chatID, jobID, src, file, caption, lang, asDocument)
+}
+
+// deliverFile mengupload file hasil yang sudah dibuka; lihat deliverResult.
+// file selalu ditutup.
+func (b *Bot) deliverFile(lg *slog.Logger, chatID int64, jobID int64, src resultSource, file *resultFile, caption string, lang string, asDocument bool) uploadMethod {
+	method := methodForContentType(file.ContentType)
+	if asDocument || b.Cfg.SendAsDocument {
+		method = methodDocument
+	}
+	b.sendChatAction(chatID, method.Action)
+
+	if file.Size > method.Limit {
+		file.Close()
+		return b.deliverOversized(lg, chatID, jobID, src, caption, lang, method)
+	}
+
+	fields := map[string]string{
+		"chat_id":    fmt.Sprintf("%d", chatID),
+		"caption":    caption,
+		"parse_mode": "HTML",
+	}
+	if method == methodVideo {
+		fields["supports_streaming"] = "true"
+	}
+	// Tombol hanya untuk gambar. Tombol file asli tidak perlu saat yang
+	// dikirim sudah file aslinya (asDocument).
+	var row []models.InlineKeyboardButton
+	if strings.HasPrefix(file.ContentType, "image/") && jobID != 0 {
+		if !asDocument {
+			row = append(row, models.InlineKeyboardButton{Text: b.Localizer.Get(lang, "btn_send_original"), CallbackData: fmt.Sprintf("orig:%d", jobID)})
+		}
+		if b.Cfg.AnimateModel != "" {
+			row = append(row, models.InlineKeyboardButton{Text: b.Localizer.Get(lang, "btn_animate"), CallbackData: fmt.Sprintf("anim:%d", jobID)})
+		}
+	}
+	if len(row) > 0 {
+		kb := models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+		kbJSON, _ := json.Marshal(kb)
+		fields["reply_markup"] = string(kbJSON)
+	}
+
+	fileName := resultFileName(jobID, file.ContentType, src.URL)
+	sent, err := b.uploadFile(chatID, method.Method, fields, method.Field, fileName, file, method.Limit, b.Cfg.UploadTimeout)
+	file.Close()
+
+	switch {
+	case err == errFileTooLarge:
+		return b.deliverOversized(lg, chatID, jobID, src, caption, lang, method)
+	case err != nil && method == methodVideo:
+		metrics.UploadErrorsTotal.Inc(method.Method)
+		lg.Warn("video upload failed, falling back to link", "err", err)
+		b.sendVideoByLink(lg, chatID, src, caption, lang)
+		return uploadMethod{}
+	case err != nil:
+		metrics.UploadErrorsTotal.Inc(method.Method)
+		lg.Error("result upload failed", "method", method.Method, "err", err)
+		b.sendMessage(chatID, b.Localizer.Get(lang, "err_send_tele"))
+		return uploadMethod{}
+	}
+
+	if jobID != 0 && sent != nil {
+		if err := b.DB.AddJobMessage(jobID, chatID, sent.MessageID); err != nil {
+			lg.Error("failed to record result message", "err", err)
+		}
+	}
+	// Simpan file_id dokumen supaya "kirim file asli" berikutnya tidak perlu upload ulang.
+	if method == methodDocument && jobID != 0 && sent != nil && sent.Document != nil {
+		if err := b.DB.SetJobDocument(jobID, sent.Document.FileID); err != nil {
+			lg.Error("failed to record document file_id", "err", err)
+		}
+	}
+	metrics.DeliveriesTotal.Inc(method.Method)
+	return method
+}
+
+// deliverOversized: foto yang terlalu besar dikirim ulang sebagai dokumen,
+// selebihnya dikirim sebagai link download.
+func (b *Bot) deliverOversized(lg *slog.Logger, chatID int64, jobID int64, src resultSource, caption string, lang string, method uploadMethod) uploadMethod {
+	if method == methodPhoto {
+		return b.deliverResult(lg, chatID, jobID, src, caption, lang, true)
+	}
+	b.sendResultLink(chatID, src, caption, lang)
+	return uploadMethod{}
+}
+
+// sendOriginal sends the lossless original of a job as a document, reusing the
+// cached Telegram file_id or the already downloaded file. It never calls Kie.
+func (b *Bot) sendOriginal(lg *slog.Logger, chatID int64, job *database.Job, lang string) {
+	if job.DocumentFileID != "" {
+		b.sendJSON(chatID, "sendDocument", models.SendDocumentRequest{ChatID: chatID, Document: job.DocumentFileID})
+		return
+	}
+	if job.ResultURL == "" {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "original_unavailable"))
+		return
+	}
+
+	src := resultSource{URL: job.ResultURL, Name: job.MediaName}
+	file, err := b.openResult(lg, src)
+	if err != nil {
+		// Tanpa salinan di media store, link Kie biasanya sudah kedaluwarsa.
+		lg.Warn("original no longer downloadable", "err", err)
+		b.sendMessage(chatID, b.Localizer.Get(lang, "original_expired"))
+		return
+	}
+	b.deliverFile(lg, chatID, job.ID, src, file, "", lang, true)
+}
+
+func (b *Bot) sendVideoByLink(lg *slog.Logger, chatID int64, src resultSource, caption, lang string) {
+	videoURL := b.resultLink(src)
+	reqBody := map[string]interface{}{
+		"chat_id":    chatID,
+		"video":      videoURL,
+		"caption":    caption,
+		"parse_mode": "HTML",
+	}
+
+	_, err := b.out.Call("sendVideo", chatID, reqBody)
+	var apiErr *APIError
+	if err != nil && !errors.As(err, &apiErr) {
+		lg.Error("video link delivery failed", "err", err)
+		b.sendMessage(chatID, b.Localizer.Get(lang, "err_send_video"))
+		return
+	}
+
+	if err != nil {
+		lg.Error("video link rejected by Telegram", "err", err)
+		b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "err_video_link"), videoURL))
+	} else {
+		metrics.DeliveriesTotal.Inc("link")
+		lg.Info("video delivered by link")
+	}
+}
+
+// sendResultLink mengirim caption beserta link download untuk file yang
+// melebihi batas upload Telegram.
+func (b *Bot) sendResultLink(chatID int64, src resultSource, caption, lang string) {
+	link := fmt.Sprintf(b.Localizer.Get(lang, "result_too_large"), b.resultLink(src))
+	if err := b.sendMessage(chatID, caption+"\n\n"+link); err == nil {
+		metrics.DeliveriesTotal.Inc("link")
+	}
+}
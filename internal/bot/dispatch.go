@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"sync"
+
+	"kieAITelegram/internal/metrics"
+	"kieAITelegram/internal/models"
+)
+
+// dispatcher menjalankan update per key (chat atau user) secara berurutan,
+// sementara key yang berbeda berjalan paralel.
+//
+// Batasnya ada dua: paling banyak `workers` key diproses bersamaan, dan
+// paling banyak `queueSize` update menunggu atau sedang diproses. Jika antrean
+// penuh, Dispatch memblokir sehingga loop getUpdates berhenti mengambil update
+// baru (backpressure); update yang belum diambil tetap disimpan Telegram.
+type dispatcher struct {
+	workers chan struct{}
+	slots   chan struct{}
+
+	mu     sync.Mutex
+	queues map[int64][]func()
+}
+
+func newDispatcher(workers, queueSize int) *dispatcher {
+	return &dispatcher{
+		workers: make(chan struct{}, workers),
+		slots:   make(chan struct{}, queueSize),
+		queues:  make(map[int64][]func()),
+	}
+}
+
+// Dispatch menjadwalkan fn setelah semua fn sebelumnya dengan key yang sama.
+func (d *dispatcher) Dispatch(key int64, fn func()) {
+	d.slots <- struct{}{}
+	metrics.UpdatesQueued.Inc()
+
+	d.mu.Lock()
+	queue, running := d.queues[key]
+	d.queues[key] = append(queue, fn)
+	d.mu.Unlock()
+
+	if !running {
+		go d.run(key)
+	}
+}
+
+// run memproses antrean satu key sampai kosong. Hanya ada satu run per key.
+func (d *dispatcher) run(key int64) {
+	d.workers <- struct{}{}
+	defer func() { <-d.workers }()
+
+	for {
+		d.mu.Lock()
+		queue := d.queues[key]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		fn := queue[0]
+		d.queues[key] = queue[1:]
+		d.mu.Unlock()
+
+		fn()
+		metrics.UpdatesQueued.Dec()
+		<-d.slots
+	}
+}
+
+// updateKey menentukan urutan update: per chat untuk pesan dan callback,
+// per user untuk inline mode (tidak punya chat).
+func updateKey(u models.TelegramUpdate) int64 {
+	switch {
+	case u.Message != nil:
+		return u.Message.Chat.ID
+	case u.CallbackQuery != nil:
+		if u.CallbackQuery.Message != nil {
+			return u.CallbackQuery.Message.Chat.ID
+		}
+		return u.CallbackQuery.From.ID
+	case u.InlineQuery != nil:
+		return u.InlineQuery.From.ID
+	case u.ChosenInlineResult != nil:
+		return u.ChosenInlineResult.From.ID
+	case u.PreCheckoutQuery != nil:
+		return u.PreCheckoutQuery.From.ID
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcherKeepsPerKeyOrder(t *testing.T) {
+	const perKey = 200
+	d := newDispatcher(4, 16)
+
+	var mu sync.Mutex
+	got := map[int64][]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < perKey; i++ {
+		for _, key := range []int64{1, 2, 3} {
+			i, key := i, key
+			wg.Add(1)
+			d.Dispatch(key, func() {
+				defer wg.Done()
+				mu.Lock()
+				got[key] = append(got[key], i)
+				mu.Unlock()
+			})
+		}
+	}
+	wg.Wait()
+
+	for _, key := range []int64{1, 2, 3} {
+		if len(got[key]) != perKey {
+			t.Fatalf("key %d ran %d updates, want %d", key, len(got[key]), perKey)
+		}
+		for i, v := range got[key] {
+			if v != i {
+				t.Fatalf("key %d: update %d ran at position %d", key, v, i)
+			}
+		}
+	}
+}
+
+func TestDispatcherBlocksWhenQueueFull(t *testing.T) {
+	d := newDispatcher(2, 2)
+	release := make(chan struct{})
+	started := make(chan int64, 2)
+	for _, key := range []int64{1, 2} {
+		key := key
+		d.Dispatch(key, func() {
+			started <- key
+			<-release
+		})
+	}
+
+	dispatched := make(chan struct{})
+	go func() {
+		d.Dispatch(3, func() {})
+		close(dispatched)
+	}()
+
+	select {
+	case <-dispatched:
+		t.Fatal("Dispatch returned while the queue was full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Satu update selesai, slot kosong, dan Dispatch yang tertahan lanjut.
+	<-started
+	<-started
+	release <- struct{}{}
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatal("Dispatch still blocked after a slot was freed")
+	}
+	close(release)
+}
+
+func TestDispatcherRunsKeysInParallel(t *testing.T) {
+	d := newDispatcher(2, 8)
+	release := make(chan struct{})
+	defer close(release)
+	d.Dispatch(1, func() { <-release })
+
+	done := make(chan struct{})
+	d.Dispatch(2, func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a slow chat blocked another chat")
+	}
+}
@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+
+	"kieAITelegram/internal/core"
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/metrics"
+	"kieAITelegram/internal/models"
+)
+
+// State setelah user memilih "Edit": prompt berikutnya langsung dipakai tanpa
+// diperbaiki lagi.
+const stateWaitingPromptEdit = "WAITING_PROMPT_EDIT"
+
+// handlePrompt is called for a text prompt in WAITING_PROMPT. If the enhancer
+// is configured and the user turned it on, the prompt is rewritten first and
+// the user picks between the rewritten and the original prompt; otherwise it
+// goes straight to generation. The enhancer runs in the chat's update
+// handler, so the next message from this chat waits for it.
+//
+// The original prompt is moderated once here, so the paths that generate it
+// afterwards call generate instead of processImageGeneration.
+func (b *Bot) handlePrompt(lg *slog.Logger, chatID int64, userID int64, prompt string, state database.UserState, lang string) {
+	if b.Enhancer == nil {
+		b.processImageGeneration(lg, chatID, userID, prompt, state, lang)
+		return
+	}
+	enabled, err := b.DB.GetEnhancePrompts(userID)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	if !enabled {
+		b.processImageGeneration(lg, chatID, userID, prompt, state, lang)
+		return
+	}
+	// Prompt yang diblokir tidak perlu dikirim ke enhancer.
+	if ok, text := b.checkPrompt(lg, userID, prompt, lang); !ok {
+		b.sendMessage(chatID, text)
+		return
+	}
+
+	statusID, err := b.sendMessageReturnID(chatID, b.Localizer.Get(lang, "enhance_working"))
+	if err != nil {
+		b.generate(lg, chatID, userID, prompt, state, lang)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.Cfg.EnhanceTimeout)
+	enhanced, err := b.Enhancer.Enhance(ctx, prompt, core.ModelType(state.SelectedModel))
+	cancel()
+	if err == nil && enhanced == "" {
+		err = errors.New("empty prompt")
+	}
+	if err != nil {
+		// Enhancer hanya tambahan: kalau gagal, prompt asli tetap diproses.
+		metrics.PromptEnhanceTotal.Inc("failed")
+		lg.Warn("prompt enhancement failed, using original prompt", "err", err)
+		b.deleteMessage(chatID, statusID)
+		b.generate(lg, chatID, userID, prompt, state, lang)
+		return
+	}
+	metrics.PromptEnhanceTotal.Inc("enhanced")
+
+	err = b.DB.SavePendingPrompt(&database.PendingPrompt{
+		UserID:    userID,
+		Original:  prompt,
+		Enhanced:  enhanced,
+		MessageID: statusID,
+	})
+	if err != nil {
+		b.deleteMessage(chatID, statusID)
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+
+	kb := models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: b.Localizer.Get(lang, "btn_enhance_use"), CallbackData: "enh:use"}},
+			{
+				{Text: b.Localizer.Get(lang, "btn_enhance_edit"), CallbackData: "enh:edit"},
+				{Text: b.Localizer.Get(lang, "btn_enhance_original"), CallbackData: "enh:orig"},
+			},
+		},
+	}
+	text := fmt.Sprintf(b.Localizer.Get(lang, "enhance_result"), html.EscapeString(enhanced), html.EscapeString(prompt))
+	b.editMessageWithKeyboard(chatID, statusID, text, kb)
+}
+
+// handleEnhanceCallback handles the Use, Edit and Use-original buttons. The
+// pending prompt is taken from the store, so each button works only once and
+// only on the latest suggestion.
+func (b *Bot) handleEnhanceCallback(lg *slog.Logger, chatID int64, messageID int64, userID int64, parts []string, lang string) {
+	if len(parts) < 2 {
+		return
+	}
+	noButtons := models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}}
+
+	pending, err := b.DB.TakePendingPrompt(userID, messageID)
+	if errors.Is(err, database.ErrNotFound) {
+		b.editMessageWithKeyboard(chatID, messageID, b.Localizer.Get(lang, "enhance_expired"), noButtons)
+		return
+	}
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	state, err := b.DB.GetUserState(userID)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	// User sudah pindah model atau menu sejak saran dibuat.
+	if state.State != "WAITING_PROMPT" || state.SelectedModel == "" {
+		b.editMessageWithKeyboard(chatID, messageID, b.Localizer.Get(lang, "enhance_expired"), noButtons)
+		return
+	}
+
+	switch parts[1] {
+	case "use":
+		metrics.PromptEnhanceChoiceTotal.Inc("use")
+		b.editMessageWithKeyboard(chatID, messageID, fmt.Sprintf(b.Localizer.Get(lang, "enhance_chosen"), html.EscapeString(pending.Enhanced)), noButtons)
+		// Prompt hasil enhancer belum pernah dimoderasi.
+		b.processImageGeneration(lg, chatID, userID, pending.Enhanced, state, lang)
+	case "orig":
+		metrics.PromptEnhanceChoiceTotal.Inc("original")
+		// Prompt asli sudah dimoderasi, tapi user bisa saja di-ban sejak itu.
+		if _, ok, text := b.checkBan(lg, userID, lang); !ok {
+			b.editMessageWithKeyboard(chatID, messageID, text, noButtons)
+			return
+		}
+		b.editMessageWithKeyboard(chatID, messageID, fmt.Sprintf(b.Localizer.Get(lang, "enhance_chosen"), html.EscapeString(pending.Original)), noButtons)
+		b.generate(lg, chatID, userID, pending.Original, state, lang)
+	case "edit":
+		metrics.PromptEnhanceChoiceTotal.Inc("edit")
+		if err := b.DB.SetUserState(userID, stateWaitingPromptEdit, state.SelectedModel); err != nil {
+			b.storeFailed(lg, chatID, lang, err)
+			return
+		}
+		b.editMessageWithKeyboard(chatID, messageID, fmt.Sprintf(b.Localizer.Get(lang, "enhance_edit"), html.EscapeString(pending.Enhanced)), noButtons)
+	}
+}
+
+// handleEditedPrompt generates the prompt the user sent after pressing Edit,
+// without enhancing it again.
+func (b *Bot) handleEditedPrompt(lg *slog.Logger, chatID int64, userID int64, prompt string, state database.UserState, lang string) {
+	if err := b.DB.SetUserState(userID, "WAITING_PROMPT", state.SelectedModel); err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	state.State = "WAITING_PROMPT"
+	b.processImageGeneration(lg, chatID, userID, prompt, state, lang)
+}
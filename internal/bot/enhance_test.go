@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/models"
+	"kieAITelegram/internal/moderation"
+)
+
+const promptUserID = int64(200)
+
+type stubEnhancer struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (e *stubEnhancer) Enhance(ctx context.Context, prompt, kind string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.prompts = append(e.prompts, prompt)
+	return "detailed " + prompt, nil
+}
+
+// countingModerator mengizinkan semua prompt dan menghitung berapa kali
+// setiap prompt diperiksa.
+type countingModerator struct {
+	mu     sync.Mutex
+	checks map[string]int
+}
+
+func (m *countingModerator) Check(ctx context.Context, userID int64, prompt string) (moderation.Verdict, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checks[prompt]++
+	return moderation.Verdict{}, nil
+}
+
+func newEnhanceBot(t *testing.T) (*Bot, *fakeTelegram, *stubEnhancer, *countingModerator) {
+	b, tg := newTestBot(t)
+	enh := &stubEnhancer{}
+	mod := &countingModerator{checks: map[string]int{}}
+	b.Enhancer = enh
+	b.Moderator = mod
+	if err := b.DB.SetUserState(promptUserID, "WAITING_PROMPT", "nano-banana"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DB.SetEnhancePrompts(promptUserID, true); err != nil {
+		t.Fatal(err)
+	}
+	return b, tg, enh, mod
+}
+
+// sendPrompt mengirim prompt dan mengembalikan ID pesan berisi tombol pilihan.
+func sendPrompt(t *testing.T, b *Bot, tg *fakeTelegram, prompt string) int64 {
+	t.Helper()
+	b.handleMessage(b.Log, privateMessage(promptUserID, prompt))
+	edit := tg.Last(t, "editMessageText").Body
+	markup, _ := edit["reply_markup"].(map[string]interface{})
+	if markup == nil || len(markup["inline_keyboard"].([]interface{})) == 0 {
+		t.Fatalf("suggestion has no buttons: %v", edit)
+	}
+	return int64(edit["message_id"].(float64))
+}
+
+func pressEnhance(b *Bot, messageID int64, choice string) {
+	msg := privateMessage(promptUserID, "")
+	msg.MessageID = messageID
+	b.handleCallback(b.Log, &models.CallbackQuery{
+		ID:      "cb",
+		Data:    "enh:" + choice,
+		From:    &models.User{ID: promptUserID},
+		Message: msg,
+	})
+}
+
+// jobPrompts mengembalikan prompt semua job yang dimulai, urut sesuai ID.
+func jobPrompts(t *testing.T, b *Bot) []string {
+	t.Helper()
+	b.jobs.Wait()
+	var prompts []string
+	for id := int64(1); ; id++ {
+		job, err := b.DB.GetJob(id)
+		if err != nil {
+			return prompts
+		}
+		prompts = append(prompts, job.Prompt)
+	}
+}
+
+func TestEnhanceUse(t *testing.T) {
+	b, tg, enh, mod := newEnhanceBot(t)
+	msgID := sendPrompt(t, b, tg, "a cat")
+	if len(enh.prompts) != 1 || enh.prompts[0] != "a cat" {
+		t.Fatalf("enhancer got %v", enh.prompts)
+	}
+	if got := jobPrompts(t, b); len(got) != 0 {
+		t.Fatalf("job started before a choice: %v", got)
+	}
+
+	pressEnhance(b, msgID, "use")
+	if got := jobPrompts(t, b); len(got) != 1 || got[0] != "detailed a cat" {
+		t.Fatalf("jobs = %v, want the enhanced prompt", got)
+	}
+	// Setiap prompt dimoderasi tepat sekali.
+	if mod.checks["a cat"] != 1 || mod.checks["detailed a cat"] != 1 {
+		t.Fatalf("moderation checks = %v", mod.checks)
+	}
+	if _, err := b.DB.TakePendingPrompt(promptUserID, msgID); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("pending prompt still stored: %v", err)
+	}
+
+	// Tombol yang sama tidak bisa dipakai dua kali.
+	pressEnhance(b, msgID, "use")
+	if got := jobPrompts(t, b); len(got) != 1 {
+		t.Fatalf("second press started another job: %v", got)
+	}
+}
+
+func TestEnhanceOriginal(t *testing.T) {
+	b, tg, _, mod := newEnhanceBot(t)
+	msgID := sendPrompt(t, b, tg, "a dog")
+
+	pressEnhance(b, msgID, "orig")
+	if got := jobPrompts(t, b); len(got) != 1 || got[0] != "a dog" {
+		t.Fatalf("jobs = %v, want the original prompt", got)
+	}
+	if mod.checks["a dog"] != 1 || mod.checks["detailed a dog"] != 0 {
+		t.Fatalf("moderation checks = %v, want the original checked once", mod.checks)
+	}
+}
+
+func TestEnhanceOriginalRechecksBan(t *testing.T) {
+	b, tg, _, _ := newEnhanceBot(t)
+	msgID := sendPrompt(t, b, tg, "a dog")
+	// Di-ban setelah saran dikirim, misal karena prompt lain.
+	if err := b.DB.SetUserBan(promptUserID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	pressEnhance(b, msgID, "orig")
+	if got := jobPrompts(t, b); len(got) != 0 {
+		t.Fatalf("banned user started jobs: %v", got)
+	}
+	want, _, _ := strings.Cut(b.Localizer.Get("en", "moderation_banned"), "%")
+	if text, _ := tg.Last(t, "editMessageText").Body["text"].(string); !strings.HasPrefix(text, want) {
+		t.Fatalf("reply = %q, want the ban message", text)
+	}
+}
+
+func TestEnhanceEdit(t *testing.T) {
+	b, tg, enh, mod := newEnhanceBot(t)
+	msgID := sendPrompt(t, b, tg, "a bird")
+
+	pressEnhance(b, msgID, "edit")
+	state, err := b.DB.GetUserState(promptUserID)
+	if err != nil || state.State != stateWaitingPromptEdit {
+		t.Fatalf("state = %+v, %v; want %s", state, err, stateWaitingPromptEdit)
+	}
+	if got := jobPrompts(t, b); len(got) != 0 {
+		t.Fatalf("edit started a job: %v", got)
+	}
+
+	// Versi yang diedit langsung dipakai, tanpa diperbaiki lagi.
+	b.handleMessage(b.Log, privateMessage(promptUserID, "a red bird"))
+	if got := jobPrompts(t, b); len(got) != 1 || got[0] != "a red bird" {
+		t.Fatalf("jobs = %v, want the edited prompt", got)
+	}
+	if len(enh.prompts) != 1 {
+		t.Fatalf("edited prompt was enhanced again: %v", enh.prompts)
+	}
+	if mod.checks["a red bird"] != 1 {
+		t.Fatalf("moderation checks = %v", mod.checks)
+	}
+	state, err = b.DB.GetUserState(promptUserID)
+	if err != nil || state.State != "WAITING_PROMPT" {
+		t.Fatalf("state = %+v, %v; want WAITING_PROMPT", state, err)
+	}
+}
+
+func TestEnhanceOffByDefault(t *testing.T) {
+	b, _, enh, mod := newEnhanceBot(t)
+	const userID = promptUserID + 1
+	if err := b.DB.SetUserState(userID, "WAITING_PROMPT", "nano-banana"); err != nil {
+		t.Fatal(err)
+	}
+
+	b.handleMessage(b.Log, privateMessage(userID, "a fish"))
+	if len(enh.prompts) != 0 {
+		t.Fatalf("enhancer called for a user who never turned it on: %v", enh.prompts)
+	}
+	if got := jobPrompts(t, b); len(got) != 1 || got[0] != "a fish" {
+		t.Fatalf("jobs = %v", got)
+	}
+	if mod.checks["a fish"] != 1 {
+		t.Fatalf("moderation checks = %v", mod.checks)
+	}
+}
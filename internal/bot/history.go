@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/models"
+)
+
+// Jumlah job per halaman /history.
+const historyPageSize = 5
+
+// historyStatusIcon menandai status job; status lain berarti masih berjalan.
+var historyStatusIcon = map[string]string{
+	"success":  "✅",
+	"failed":   "❌",
+	"timeout":  "⌛",
+	"canceled": "🛑",
+}
+
+// showHistory menampilkan satu halaman history job user, terbaru dulu.
+// before adalah ID job terakhir di halaman sebelumnya (0 untuk halaman
+// pertama). messageID != 0 berarti halaman diedit di pesan yang sama.
+func (b *Bot) showHistory(lg *slog.Logger, chatID int64, messageID int64, userID int64, before int64, lang string) {
+	// Ambil satu job lebih untuk tahu apakah masih ada halaman berikutnya.
+	jobs, err := b.DB.ListJobs(userID, historyPageSize+1, before)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	if len(jobs) == 0 {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "history_empty"))
+		return
+	}
+	more := len(jobs) > historyPageSize
+	if more {
+		jobs = jobs[:historyPageSize]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(b.Localizer.Get(lang, "history_title"))
+	for _, job := range jobs {
+		sb.WriteString(b.historyEntry(&job, lang))
+	}
+
+	kb := models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}}
+	if more {
+		next := fmt.Sprintf("hist:%d", jobs[len(jobs)-1].ID)
+		kb.InlineKeyboard = append(kb.InlineKeyboard, []models.InlineKeyboardButton{{Text: b.Localizer.Get(lang, "btn_history_older"), CallbackData: next}})
+	}
+	if messageID != 0 {
+		b.editMessageWithKeyboard(chatID, messageID, sb.String(), kb)
+		return
+	}
+	b.sendMessageWithKeyboard(chatID, sb.String(), kb)
+}
+
+// historyEntry memformat satu job. Hasil yang sukses diberi link dari media
+// store jika ada, jadi masih bisa dibuka setelah link Kie kedaluwarsa.
+func (b *Bot) historyEntry(job *database.Job, lang string) string {
+	prompt := job.Prompt
+	if runes := []rune(prompt); len(runes) > 100 {
+		prompt = string(runes[:100]) + "..."
+	}
+	icon, ok := historyStatusIcon[job.Status]
+	if !ok {
+		icon = "⏳"
+	}
+	entry := fmt.Sprintf(b.Localizer.Get(lang, "history_entry"), icon, job.ID, job.CreatedAt.Format("2006-01-02 15:04"),
+		html.EscapeString(job.ModelID), html.EscapeString(prompt))
+	if job.Status == "success" && job.ResultURL != "" {
+		link := b.resultLink(resultSource{URL: job.ResultURL, Name: job.MediaName})
+		entry += fmt.Sprintf(b.Localizer.Get(lang, "history_link"), html.EscapeString(link))
+	}
+	return entry
+}
+
+// handleHistoryCallback membuka halaman history berikutnya ("hist:<before>").
+func (b *Bot) handleHistoryCallback(lg *slog.Logger, chatID int64, messageID int64, userID int64, parts []string, lang string) {
+	if len(parts) < 2 {
+		return
+	}
+	before, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || before <= 0 {
+		return
+	}
+	b.showHistory(lg, chatID, messageID, userID, before, lang)
+}
@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"kieAITelegram/internal/core"
+	"kieAITelegram/internal/metrics"
+	"kieAITelegram/internal/models"
+	"log/slog"
+	"strings"
+)
+
+const inlineResultID = "gen"
+
+func (b *Bot) handleInlineQuery(lg *slog.Logger, q *models.InlineQuery) {
+	lang := b.userLang(q.From.ID)
+	prompt := strings.TrimSpace(q.Query)
+
+	req := models.AnswerInlineQueryRequest{
+		InlineQueryID: q.ID,
+		Results:       []models.InlineQueryResultArticle{},
+		CacheTime:     0,
+		IsPersonal:    true,
+	}
+
+	modelID, _ := b.inlineModelForUser(q.From.ID)
+	model := core.GetModelByID(modelID)
+
+	if prompt != "" && model != nil {
+		// Inline message hanya punya inline_message_id jika ada keyboard terpasang.
+		kb := models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: b.Localizer.Get(lang, "inline_btn_wait"), CallbackData: "noop"}},
+			},
+		}
+		req.Results = append(req.Results, models.InlineQueryResultArticle{
+			Type:        "article",
+			ID:          inlineResultID,
+			Title:       fmt.Sprintf(b.Localizer.Get(lang, "inline_title"), model.Name),
+			Description: prompt,
+			InputMessageContent: models.InputTextMessage{
+				MessageText: fmt.Sprintf(b.Localizer.Get(lang, "gen_start"), model.Name),
+				ParseMode:   "HTML",
+			},
+			ReplyMarkup: &kb,
+		})
+	}
+
+	b.sendJSON(0, "answerInlineQuery", req)
+}
+
+func (b *Bot) handleChosenInlineResult(lg *slog.Logger, r *models.ChosenInlineResult) {
+	if r.ResultID != inlineResultID || r.InlineMessageID == "" {
+		return
+	}
+
+	userID := r.From.ID
+	lang := b.userLang(userID)
+	prompt := strings.TrimSpace(r.Query)
+	modelID, options := b.inlineModelForUser(userID)
+	model := core.GetModelByID(modelID)
+	if model == nil {
+		b.editInlineText(r.InlineMessageID, b.Localizer.Get(lang, "error_model_not_found"))
+		return
+	}
+
+	lg = lg.With("inline_message_id", r.InlineMessageID, "model", model.ID)
+
+	if ok, text := b.checkPrompt(lg, userID, prompt, lang); !ok {
+		b.editInlineText(r.InlineMessageID, text)
+		return
+	}
+	// Inline juga memakai kuota; job dicatat tanpa chat (chat_id 0).
+	jobID, ok, text := b.startJob(lg, userID, 0, model.ID, core.ModelType(model.ID), prompt, lang)
+	if !ok {
+		b.editInlineText(r.InlineMessageID, text)
+		return
+	}
+	lg = lg.With("job_id", jobID)
+
+	b.jobs.Add(1)
+	go func() {
+		defer b.jobs.Done()
+		metrics.ActiveJobs.Inc()
+		defer metrics.ActiveJobs.Dec()
+
+		taskID, err := b.KieClient.CreateTaskComplex(prompt, model.APIModelID, options)
+		if err != nil {
+			b.finishJob(jobID, model.ID, "failed", "", "")
+			lg.Error("failed to create inline Kie task", "err", err)
+			b.editInlineText(r.InlineMessageID, b.Localizer.Get(lang, "gen_fail_start"))
+			return
+		}
+
+		lg := lg.With("task_id", taskID)
+		lg.Info("inline job started")
+		if err := b.DB.SetJobTask(jobID, taskID); err != nil {
+			lg.Error("failed to record job task", "err", err)
+		}
+		result, err := b.waitForTask(b.ctx, lg, taskID, model.ID, nil)
+		if errors.Is(err, errTaskTimeout) {
+			b.finishJob(jobID, model.ID, "timeout", "", "")
+			lg.Warn("inline job timed out")
+			b.editInlineText(r.InlineMessageID, fmt.Sprintf(b.Localizer.Get(lang, "gen_timeout"), b.limitsFor(model.ID).Timeout))
+			return
+		}
+		if err != nil {
+			// Bot berhenti sebelum task selesai.
+			b.finishJob(jobID, model.ID, "canceled", "", "")
+			lg.Info("inline job canceled", "err", err)
+			b.editInlineText(r.InlineMessageID, b.Localizer.Get(lang, "gen_interrupted"))
+			return
+		}
+		if result.FailMsg != "" {
+			b.finishJob(jobID, model.ID, "failed", "", "")
+			b.editInlineText(r.InlineMessageID, fmt.Sprintf(b.Localizer.Get(lang, "gen_fail"), result.FailMsg))
+			return
+		}
+		if len(result.URLs) == 0 {
+			b.finishJob(jobID, model.ID, "failed", "", "")
+			b.editInlineText(r.InlineMessageID, b.Localizer.Get(lang, "gen_result_empty"))
+			return
+		}
+
+		// Inline message tidak bisa menerima upload file baru, jadi kirim via URL.
+		b.finishJob(jobID, model.ID, "success", result.URLs[0], "")
+		err = b.sendJSON(0, "editMessageMedia", models.EditInlineMessageMediaRequest{
+			InlineMessageID: r.InlineMessageID,
+			Media: models.InputMediaPhoto{
+				Type:      "photo",
+				Media:     result.URLs[0],
+				Caption:   b.buildCaption(model.ID, prompt, options, lang),
+				ParseMode: "HTML",
+			},
+		})
+		if err == nil {
+			metrics.DeliveriesTotal.Inc("editMessageMedia")
+		}
+	}()
+}
+
+// inlineModelForUser returns the user's selected image model with its draft
+// options, or the default inline model when none is usable. Uploaded images
+// are never reused for inline jobs, so models that require an input image
+// fall back to the default too.
+func (b *Bot) inlineModelForUser(userID int64) (string, map[string]interface{}) {
+	options := make(map[string]interface{})
+	state, err := b.DB.GetUserState(userID)
+	if err != nil {
+		b.Log.Error("failed to read user state", "user_id", userID, "err", err)
+		return b.Cfg.InlineDefaultModel, options
+	}
+
+	model := core.GetModelByID(state.SelectedModel)
+	if model == nil || core.GetProviderForModel(model.ID).Type == "video" || model.RequiresImage {
+		return b.Cfg.InlineDefaultModel, options
+	}
+
+	for key, val := range state.DraftOptions {
+		if key != "image_input" {
+			options[key] = val
+		}
+	}
+	return model.ID, options
+}
+
+func (b *Bot) editInlineText(inlineMessageID string, text string) {
+	b.sendJSON(0, "editMessageText", models.EditInlineMessageTextRequest{
+		InlineMessageID: inlineMessageID,
+		Text:            text,
+		ParseMode:       "HTML",
+	})
+}
@@ -0,0 +1,150 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/metrics"
+)
+
+// Jumlah entri yang ditampilkan /modlog.
+const modLogLimit = 20
+
+// checkPrompt runs moderation before a job is recorded, so a blocked prompt
+// uses no quota or credits. Banned users cannot generate at all. If the check
+// itself fails the prompt is allowed: moderation must not take the bot down
+// with it. When ok is false, text is the message to show the user.
+func (b *Bot) checkPrompt(lg *slog.Logger, userID int64, prompt string, lang string) (ok bool, text string) {
+	bannedUntil, ok, text := b.checkBan(lg, userID, lang)
+	if !ok {
+		return false, text
+	}
+	now := time.Now()
+	if b.Moderator == nil {
+		return true, ""
+	}
+
+	verdict, err := b.Moderator.Check(context.Background(), userID, prompt)
+	if err != nil {
+		metrics.ModerationErrorsTotal.Inc()
+		lg.Warn("moderation check failed, prompt allowed", "err", err)
+		return true, ""
+	}
+	if !verdict.Blocked {
+		return true, ""
+	}
+
+	metrics.ModerationBlockedTotal.Inc(verdict.Source)
+	lg.Info("prompt blocked", "source", verdict.Source, "reason", verdict.Reason)
+	err = b.DB.AddModerationLog(&database.ModerationEntry{
+		UserID: userID,
+		Prompt: prompt,
+		Source: verdict.Source,
+		Reason: verdict.Reason,
+	})
+	if err != nil {
+		lg.Error("failed to record blocked prompt", "err", err)
+		return false, b.Localizer.Get(lang, "moderation_blocked_plain")
+	}
+	if b.Cfg.ModerationStrikes <= 0 {
+		return false, b.Localizer.Get(lang, "moderation_blocked_plain")
+	}
+
+	// Strike sebelum ban terakhir berakhir tidak dihitung lagi.
+	since := now.Add(-b.Cfg.ModerationStrikeWindow)
+	if bannedUntil.After(since) {
+		since = bannedUntil
+	}
+	strikes, err := b.DB.CountModerationSince(userID, since)
+	if err != nil {
+		lg.Error("failed to count strikes", "err", err)
+		return false, b.Localizer.Get(lang, "moderation_blocked_plain")
+	}
+	if strikes < b.Cfg.ModerationStrikes {
+		return false, fmt.Sprintf(b.Localizer.Get(lang, "moderation_blocked"), strikes, b.Cfg.ModerationStrikes)
+	}
+
+	until := now.Add(b.Cfg.ModerationBanDuration)
+	if err := b.DB.SetUserBan(userID, until); err != nil {
+		lg.Error("failed to ban user", "err", err)
+		return false, b.Localizer.Get(lang, "moderation_blocked_plain")
+	}
+	lg.Warn("user banned", "strikes", strikes, "until", until)
+	return false, fmt.Sprintf(b.Localizer.Get(lang, "moderation_banned_now"), b.formatResetTime(until))
+}
+
+// checkBan menolak user yang sedang di-ban. bannedUntil tetap dikembalikan
+// karena strike sebelum ban terakhir tidak dihitung lagi.
+func (b *Bot) checkBan(lg *slog.Logger, userID int64, lang string) (bannedUntil time.Time, ok bool, text string) {
+	bannedUntil, err := b.DB.GetUserBan(userID)
+	if err != nil {
+		lg.Error("failed to read user ban", "err", err)
+		return bannedUntil, false, b.Localizer.Get(lang, "error_generic")
+	}
+	if time.Now().Before(bannedUntil) {
+		return bannedUntil, false, fmt.Sprintf(b.Localizer.Get(lang, "moderation_banned"), b.formatResetTime(bannedUntil))
+	}
+	return bannedUntil, true, ""
+}
+
+// handleModLog menangani perintah admin "/modlog [user_id]".
+func (b *Bot) handleModLog(lg *slog.Logger, chatID int64, text string, lang string) {
+	var userID int64
+	if fields := strings.Fields(text); len(fields) > 1 {
+		id, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || id <= 0 {
+			b.sendMessage(chatID, b.Localizer.Get(lang, "modlog_usage"))
+			return
+		}
+		userID = id
+	}
+
+	entries, err := b.DB.ListModerationLog(userID, modLogLimit)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	if len(entries) == 0 {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "modlog_empty"))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(b.Localizer.Get(lang, "modlog_title"))
+	for _, e := range entries {
+		prompt := e.Prompt
+		if runes := []rune(prompt); len(runes) > 200 {
+			prompt = string(runes[:200]) + "..."
+		}
+		sb.WriteString(fmt.Sprintf(b.Localizer.Get(lang, "modlog_entry"), e.UserID, b.formatResetTime(e.CreatedAt),
+			html.EscapeString(e.Source), html.EscapeString(e.Reason), html.EscapeString(prompt)))
+	}
+	b.sendMessage(chatID, sb.String())
+}
+
+// handleUnban menangani perintah admin "/unban <user_id>". Ban diakhiri
+// sekarang, jadi strike sebelumnya juga tidak dihitung lagi.
+func (b *Bot) handleUnban(lg *slog.Logger, chatID int64, text string, lang string) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "unban_usage"))
+		return
+	}
+	targetID, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || targetID <= 0 {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "unban_usage"))
+		return
+	}
+	if err := b.DB.SetUserBan(targetID, time.Now()); err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	lg.Info("user unbanned", "target_user_id", targetID)
+	b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "unban_done"), targetID))
+}
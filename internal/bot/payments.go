@@ -0,0 +1,219 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/metrics"
+	"kieAITelegram/internal/models"
+)
+
+// Mata uang Telegram Stars. Invoice XTR tidak memakai provider token.
+const starsCurrency = "XTR"
+
+// invoicePayload menyimpan isi paket di invoice, jadi pembayaran tetap bisa
+// dikreditkan walaupun CREDIT_PACKAGES berubah setelah invoice dikirim.
+func invoicePayload(pkg models.CreditPackage) string {
+	return fmt.Sprintf("credits:%d:%d", pkg.Credits, pkg.Stars)
+}
+
+func parseInvoicePayload(payload string) (models.CreditPackage, bool) {
+	parts := strings.Split(payload, ":")
+	if len(parts) != 3 || parts[0] != "credits" {
+		return models.CreditPackage{}, false
+	}
+	credits, err1 := strconv.Atoi(parts[1])
+	stars, err2 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || credits < 1 || stars < 1 {
+		return models.CreditPackage{}, false
+	}
+	return models.CreditPackage{Credits: credits, Stars: stars}, true
+}
+
+// creditPackage mencari paket yang masih dijual.
+func (b *Bot) creditPackage(credits int, stars int) (models.CreditPackage, bool) {
+	for _, pkg := range b.Cfg.CreditPackages {
+		if pkg.Credits == credits && pkg.Stars == stars {
+			return pkg, true
+		}
+	}
+	return models.CreditPackage{}, false
+}
+
+// showBuyMenu menjawab perintah /buy.
+func (b *Bot) showBuyMenu(lg *slog.Logger, chatID int64, userID int64, lang string) {
+	if len(b.Cfg.CreditPackages) == 0 {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "buy_unavailable"))
+		return
+	}
+	balance, err := b.DB.GetCreditBalance(userID)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+
+	var rows [][]models.InlineKeyboardButton
+	for _, pkg := range b.Cfg.CreditPackages {
+		rows = append(rows, []models.InlineKeyboardButton{{
+			Text:         fmt.Sprintf(b.Localizer.Get(lang, "btn_buy_package"), pkg.Credits, pkg.Stars),
+			CallbackData: fmt.Sprintf("buy:%d:%d", pkg.Credits, pkg.Stars),
+		}})
+	}
+	b.sendMessageWithKeyboard(chatID, fmt.Sprintf(b.Localizer.Get(lang, "buy_title"), balance),
+		models.InlineKeyboardMarkup{InlineKeyboard: rows})
+}
+
+// handleBuyCallback mengirim invoice untuk tombol "buy:<kredit>:<stars>".
+func (b *Bot) handleBuyCallback(lg *slog.Logger, chatID int64, parts []string, lang string) {
+	if len(parts) != 3 {
+		return
+	}
+	credits, _ := strconv.Atoi(parts[1])
+	stars, _ := strconv.Atoi(parts[2])
+	pkg, ok := b.creditPackage(credits, stars)
+	if !ok {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "buy_unavailable"))
+		return
+	}
+
+	title := fmt.Sprintf(b.Localizer.Get(lang, "invoice_title"), pkg.Credits)
+	err := b.sendJSON(chatID, "sendInvoice", models.SendInvoiceRequest{
+		ChatID:      chatID,
+		Title:       title,
+		Description: fmt.Sprintf(b.Localizer.Get(lang, "invoice_description"), pkg.Credits),
+		Payload:     invoicePayload(pkg),
+		Currency:    starsCurrency,
+		Prices:      []models.LabeledPrice{{Label: title, Amount: pkg.Stars}},
+	})
+	if err != nil {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "error_generic"))
+		return
+	}
+	lg.Info("invoice sent", "credits", pkg.Credits, "stars", pkg.Stars)
+}
+
+// handlePreCheckout menyetujui pembayaran hanya untuk paket yang masih dijual
+// dengan harga yang sama. Telegram menunggu jawaban maksimal 10 detik.
+func (b *Bot) handlePreCheckout(lg *slog.Logger, q *models.PreCheckoutQuery) {
+	answer := models.AnswerPreCheckoutQueryRequest{PreCheckoutQueryID: q.ID, Ok: true}
+	pkg, ok := parseInvoicePayload(q.InvoicePayload)
+	if ok {
+		_, ok = b.creditPackage(pkg.Credits, pkg.Stars)
+	}
+	if !ok || q.Currency != starsCurrency || q.TotalAmount != pkg.Stars {
+		lg.Warn("pre-checkout rejected", "payload", q.InvoicePayload, "currency", q.Currency, "amount", q.TotalAmount)
+		answer.Ok = false
+		answer.ErrorMessage = b.Localizer.Get(b.userLang(q.From.ID), "buy_unavailable")
+	}
+	b.sendJSON(0, "answerPreCheckoutQuery", answer)
+}
+
+// handleSuccessfulPayment mengkreditkan pembelian. Pesan yang sama bisa
+// datang lagi (misal setelah restart sebelum offset tersimpan); charge ID
+// memastikan kredit hanya ditambahkan sekali.
+func (b *Bot) handleSuccessfulPayment(lg *slog.Logger, msg *models.TelegramMessage) {
+	sp := msg.SuccessfulPayment
+	chatID := msg.Chat.ID
+	userID := msg.From.ID
+	lang := b.userLang(userID)
+	lg = lg.With("charge_id", sp.TelegramPaymentChargeID)
+
+	pkg, ok := parseInvoicePayload(sp.InvoicePayload)
+	if !ok || sp.Currency != starsCurrency || sp.TotalAmount != pkg.Stars {
+		// Stars sudah diterima; admin bisa me-refund dengan charge ID ini.
+		lg.Error("payment does not match its invoice", "payload", sp.InvoicePayload,
+			"currency", sp.Currency, "amount", sp.TotalAmount)
+		b.sendMessage(chatID, b.Localizer.Get(lang, "error_generic"))
+		return
+	}
+
+	applied, err := b.DB.RecordPurchase(&database.Payment{
+		ChargeID: sp.TelegramPaymentChargeID,
+		UserID:   userID,
+		Credits:  pkg.Credits,
+		Stars:    pkg.Stars,
+		Payload:  sp.InvoicePayload,
+	})
+	if err != nil {
+		lg.Error("failed to record payment", "err", err)
+		b.sendMessage(chatID, b.Localizer.Get(lang, "error_generic"))
+		return
+	}
+	if !applied {
+		lg.Info("payment already recorded")
+		return
+	}
+	metrics.PaymentsTotal.Inc("paid")
+	lg.Info("payment received", "credits", pkg.Credits, "stars", pkg.Stars)
+
+	balance, err := b.DB.GetCreditBalance(userID)
+	if err != nil {
+		lg.Error("failed to read credit balance", "err", err)
+	}
+	b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "payment_success"), pkg.Credits, balance))
+}
+
+// handleRefundedPayment mencatat refund yang terjadi di luar /refund.
+func (b *Bot) handleRefundedPayment(lg *slog.Logger, msg *models.TelegramMessage) {
+	chargeID := msg.RefundedPayment.TelegramPaymentChargeID
+	lg = lg.With("charge_id", chargeID)
+	applied, err := b.DB.RefundPurchase(chargeID)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		lg.Warn("refund for unknown payment")
+	case err != nil:
+		lg.Error("failed to record refund", "err", err)
+	case applied:
+		metrics.PaymentsTotal.Inc("refunded")
+		lg.Info("payment refunded")
+	}
+}
+
+// handleRefund menangani perintah admin "/refund <charge_id>": Stars
+// dikembalikan lewat refundStarPayment, lalu kreditnya ditarik.
+func (b *Bot) handleRefund(lg *slog.Logger, chatID int64, text string, lang string) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "refund_usage"))
+		return
+	}
+	chargeID := fields[1]
+	lg = lg.With("charge_id", chargeID)
+
+	p, err := b.DB.GetPayment(chargeID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && p.Status != database.PaymentPaid) {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "refund_not_found"))
+		return
+	}
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+
+	_, err = b.out.Call("refundStarPayment", 0, models.RefundStarPaymentRequest{
+		UserID:                  p.UserID,
+		TelegramPaymentChargeID: chargeID,
+	})
+	if err != nil {
+		lg.Warn("refundStarPayment failed", "err", err)
+		b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "refund_failed"), html.EscapeString(err.Error())))
+		return
+	}
+	applied, err := b.DB.RefundPurchase(chargeID)
+	if err != nil {
+		// Stars sudah kembali ke user; kredit harus ditarik manual.
+		lg.Error("refund sent but not recorded", "target_user_id", p.UserID, "err", err)
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	if applied {
+		metrics.PaymentsTotal.Inc("refunded")
+	}
+	lg.Info("payment refunded by admin", "target_user_id", p.UserID, "credits", p.Credits, "stars", p.Stars)
+	b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "refund_done"), p.Stars, p.UserID, p.Credits))
+}
@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/models"
+)
+
+const (
+	buyerID = int64(100)
+	adminID = int64(1)
+)
+
+func newPaymentsBot(t *testing.T) (*Bot, *fakeTelegram) {
+	b, tg := newTestBot(t)
+	b.Cfg.CreditPackages = []models.CreditPackage{{Credits: 50, Stars: 25}}
+	b.Cfg.AdminIDs = []int64{adminID}
+	return b, tg
+}
+
+func paymentMessage(chargeID string, payload string, amount int) models.TelegramUpdate {
+	msg := privateMessage(buyerID, "")
+	msg.SuccessfulPayment = &models.SuccessfulPayment{
+		Currency:                starsCurrency,
+		TotalAmount:             amount,
+		InvoicePayload:          payload,
+		TelegramPaymentChargeID: chargeID,
+	}
+	return models.TelegramUpdate{Message: msg}
+}
+
+func creditBalance(t *testing.T, b *Bot, userID int64) int {
+	t.Helper()
+	balance, err := b.DB.GetCreditBalance(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
+
+func TestBuySendsStarsInvoice(t *testing.T) {
+	b, tg := newPaymentsBot(t)
+	b.handleCallback(b.Log, &models.CallbackQuery{
+		ID:      "cb",
+		Data:    "buy:50:25",
+		From:    &models.User{ID: buyerID},
+		Message: privateMessage(buyerID, ""),
+	})
+
+	inv := tg.Last(t, "sendInvoice").Body
+	if inv["currency"] != "XTR" || inv["payload"] != "credits:50:25" {
+		t.Fatalf("invoice = %v", inv)
+	}
+	if _, ok := inv["provider_token"]; ok && inv["provider_token"] != "" {
+		t.Fatalf("Stars invoice has a provider token: %v", inv["provider_token"])
+	}
+	prices, _ := inv["prices"].([]interface{})
+	if len(prices) != 1 || prices[0].(map[string]interface{})["amount"] != float64(25) {
+		t.Fatalf("prices = %v", inv["prices"])
+	}
+
+	// Paket yang tidak dijual tidak mendapat invoice.
+	b.handleCallback(b.Log, &models.CallbackQuery{
+		ID:      "cb2",
+		Data:    "buy:500:1",
+		From:    &models.User{ID: buyerID},
+		Message: privateMessage(buyerID, ""),
+	})
+	if n := len(tg.Calls("sendInvoice")); n != 1 {
+		t.Fatalf("%d invoices sent, want 1", n)
+	}
+}
+
+func TestPreCheckout(t *testing.T) {
+	cases := []struct {
+		name     string
+		currency string
+		amount   int
+		payload  string
+		ok       bool
+	}{
+		{"valid", "XTR", 25, "credits:50:25", true},
+		{"wrong amount", "XTR", 20, "credits:50:25", false},
+		{"wrong currency", "USD", 25, "credits:50:25", false},
+		{"package no longer sold", "XTR", 10, "credits:20:10", false},
+		{"bad payload", "XTR", 25, "hello", false},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b, tg := newPaymentsBot(t)
+			id := fmt.Sprintf("q%d", i)
+			b.handleUpdate(models.TelegramUpdate{PreCheckoutQuery: &models.PreCheckoutQuery{
+				ID:             id,
+				From:           &models.User{ID: buyerID},
+				Currency:       c.currency,
+				TotalAmount:    c.amount,
+				InvoicePayload: c.payload,
+			}})
+
+			answer := tg.Last(t, "answerPreCheckoutQuery").Body
+			if answer["pre_checkout_query_id"] != id || answer["ok"] != c.ok {
+				t.Fatalf("answer = %v, want ok=%v", answer, c.ok)
+			}
+			if !c.ok && answer["error_message"] == "" {
+				t.Fatal("rejection without an error message")
+			}
+		})
+	}
+}
+
+func TestSuccessfulPaymentCreditsOnce(t *testing.T) {
+	b, tg := newPaymentsBot(t)
+
+	b.handleUpdate(paymentMessage("charge-1", "credits:50:25", 25))
+	if got := creditBalance(t, b, buyerID); got != 50 {
+		t.Fatalf("balance = %d, want 50", got)
+	}
+	if n := len(tg.Calls("sendMessage")); n != 1 {
+		t.Fatalf("%d messages after payment, want 1", n)
+	}
+
+	// Update yang sama datang lagi: charge ID sudah tercatat, tidak dikreditkan ulang.
+	b.handleUpdate(paymentMessage("charge-1", "credits:50:25", 25))
+	if got := creditBalance(t, b, buyerID); got != 50 {
+		t.Fatalf("balance after duplicate = %d, want 50", got)
+	}
+	if n := len(tg.Calls("sendMessage")); n != 1 {
+		t.Fatalf("duplicate payment was announced again")
+	}
+	applied, err := b.DB.RecordPurchase(&database.Payment{ChargeID: "charge-1", UserID: buyerID, Credits: 50, Stars: 25})
+	if err != nil || applied {
+		t.Fatalf("RecordPurchase(repeated charge) = %v, %v; want false, nil", applied, err)
+	}
+
+	// Jumlah yang tidak cocok dengan payload tidak dikreditkan.
+	b.handleUpdate(paymentMessage("charge-2", "credits:50:25", 1))
+	if got := creditBalance(t, b, buyerID); got != 50 {
+		t.Fatalf("balance after mismatched payment = %d, want 50", got)
+	}
+}
+
+func TestRefundIsIdempotent(t *testing.T) {
+	b, tg := newPaymentsBot(t)
+	b.handleUpdate(paymentMessage("charge-1", "credits:50:25", 25))
+
+	b.handleRefund(b.Log, adminID, "/refund charge-1", "en")
+	refund := tg.Last(t, "refundStarPayment").Body
+	if refund["telegram_payment_charge_id"] != "charge-1" || refund["user_id"] != float64(buyerID) {
+		t.Fatalf("refundStarPayment = %v", refund)
+	}
+	if got := creditBalance(t, b, buyerID); got != 0 {
+		t.Fatalf("balance after refund = %d, want 0", got)
+	}
+	p, err := b.DB.GetPayment("charge-1")
+	if err != nil || p.Status != database.PaymentRefunded {
+		t.Fatalf("payment = %+v, %v; want refunded", p, err)
+	}
+
+	// Telegram juga mengirim refunded_payment; kredit tidak ditarik dua kali.
+	msg := privateMessage(buyerID, "")
+	msg.RefundedPayment = &models.RefundedPayment{Currency: starsCurrency, TotalAmount: 25,
+		InvoicePayload: "credits:50:25", TelegramPaymentChargeID: "charge-1"}
+	b.handleUpdate(models.TelegramUpdate{Message: msg})
+	if got := creditBalance(t, b, buyerID); got != 0 {
+		t.Fatalf("balance after second refund = %d, want 0", got)
+	}
+
+	// /refund kedua ditolak tanpa memanggil Telegram lagi.
+	b.handleRefund(b.Log, adminID, "/refund charge-1", "en")
+	if n := len(tg.Calls("refundStarPayment")); n != 1 {
+		t.Fatalf("refundStarPayment called %d times, want 1", n)
+	}
+	applied, err := b.DB.RefundPurchase("charge-1")
+	if err != nil || applied {
+		t.Fatalf("RefundPurchase(again) = %v, %v; want false, nil", applied, err)
+	}
+}
+
+// Kredit job dikembalikan jika job tidak menghasilkan apa-apa.
+func TestFinishJobReturnsCredits(t *testing.T) {
+	cases := []struct {
+		status  string
+		balance int
+	}{
+		{"success", 7},
+		{"failed", 10},
+		{"timeout", 10},
+		{"canceled", 10},
+	}
+	for _, c := range cases {
+		t.Run(c.status, func(t *testing.T) {
+			b, _ := newTestBot(t)
+			if _, err := b.DB.AddCredits(buyerID, 10, database.CreditPurchase, "charge-1"); err != nil {
+				t.Fatal(err)
+			}
+			jobID, err := b.DB.CreateJob(buyerID, buyerID, "nano-banana", "image", "a cat")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.DB.AddCredits(buyerID, -3, database.CreditSpend, jobRef(jobID)); err != nil {
+				t.Fatal(err)
+			}
+
+			b.finishJob(jobID, "nano-banana", c.status, "", "")
+
+			balance, err := b.DB.GetCreditBalance(buyerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if balance != c.balance {
+				t.Fatalf("balance = %d, want %d", balance, c.balance)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/models"
+)
+
+// Tier khusus yang bisa diberikan admin walaupun tidak ada di QUOTAS:
+// semua tier yang tidak dikonfigurasi memang tidak dibatasi.
+const unlimitedTier = "unlimited"
+
+var quotaKinds = []string{"image", "video"}
+
+// quotaPeriod mengembalikan awal periode yang sedang berjalan dan waktu reset
+// berikutnya. Batas periode dihitung di zona waktu loc (tengah malam lokal,
+// minggu mulai Senin), lalu dibandingkan sebagai waktu absolut, jadi hasilnya
+// benar apa pun zona waktu server dan database.
+func quotaPeriod(now time.Time, loc *time.Location, period string) (start, next time.Time) {
+	t := now.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch period {
+	case "week":
+		start = day.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	case "month":
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	}
+	return day, day.AddDate(0, 0, 1)
+}
+
+type quotaStatus struct {
+	Kind    string
+	Limited bool
+	Limit   models.QuotaLimit
+	Used    int
+	ResetAt time.Time
+}
+
+func (q quotaStatus) Exhausted() bool {
+	return q.Limited && q.Used >= q.Limit.Limit
+}
+
+func (q quotaStatus) Left() int {
+	if left := q.Limit.Limit - q.Used; left > 0 {
+		return left
+	}
+	return 0
+}
+
+// userTier returns the user's tier, or the default tier for new users or when
+// the lookup fails.
+func (b *Bot) userTier(userID int64) string {
+	tier, err := b.DB.GetUserTier(userID)
+	if err != nil {
+		if !errors.Is(err, database.ErrNotFound) {
+			b.Log.Error("failed to read user tier", "user_id", userID, "err", err)
+		}
+		return models.DefaultTier
+	}
+	return tier
+}
+
+func (b *Bot) quotaStatus(userID int64, tier string, kind string) (quotaStatus, error) {
+	status := quotaStatus{Kind: kind}
+	limit, ok := b.Cfg.Quotas[tier][kind]
+	if !ok {
+		return status, nil
+	}
+
+	start, next := quotaPeriod(time.Now(), b.quotaLoc, limit.Period)
+	used, err := b.DB.CountJobsSince(userID, kind, start)
+	if err != nil {
+		return status, err
+	}
+	status.Limited = true
+	status.Limit = limit
+	status.Used = used
+	status.ResetAt = next
+	return status, nil
+}
+
+// startJob records a new job of kind if the user may start one: within the
+// quota, or else paid with credits (CREDIT_COSTS). It must run before the Kie
+// task is created. When ok is false, text is the message to show the user.
+// A failed job gets its credits back in finishJob.
+func (b *Bot) startJob(lg *slog.Logger, userID int64, chatID int64, modelID string, kind string, prompt string, lang string) (jobID int64, ok bool, text string) {
+	status, err := b.quotaStatus(userID, b.userTier(userID), kind)
+	if err != nil {
+		lg.Error("failed to check quota", "err", err)
+		return 0, false, b.Localizer.Get(lang, "error_generic")
+	}
+	if !status.Exhausted() {
+		jobID, err := b.DB.CreateJob(userID, chatID, modelID, kind, prompt)
+		if err != nil {
+			lg.Error("failed to record job", "err", err)
+			return 0, false, b.Localizer.Get(lang, "error_generic")
+		}
+		return jobID, true, ""
+	}
+
+	lg.Info("quota exhausted", "kind", kind, "used", status.Used, "limit", status.Limit.Limit)
+	text = fmt.Sprintf(b.Localizer.Get(lang, "quota_exceeded"),
+		b.Localizer.Get(lang, "quota_kind_"+kind), status.Used, status.Limit.Limit,
+		b.Localizer.Get(lang, "quota_period_"+status.Limit.Period), b.formatResetTime(status.ResetAt))
+	cost := b.Cfg.CreditCosts[kind]
+	if cost <= 0 {
+		return 0, false, text
+	}
+	balance, err := b.DB.GetCreditBalance(userID)
+	if err != nil {
+		lg.Error("failed to read credit balance", "err", err)
+		return 0, false, b.Localizer.Get(lang, "error_generic")
+	}
+	text += fmt.Sprintf(b.Localizer.Get(lang, "quota_buy_hint"), cost, balance)
+	if balance < cost {
+		return 0, false, text
+	}
+
+	// Job dicatat dulu supaya kredit bisa diikat ke job ID-nya.
+	jobID, err = b.DB.CreateJob(userID, chatID, modelID, kind, prompt)
+	if err != nil {
+		lg.Error("failed to record job", "err", err)
+		return 0, false, b.Localizer.Get(lang, "error_generic")
+	}
+	if _, err := b.DB.AddCredits(userID, -cost, database.CreditSpend, jobRef(jobID)); err != nil {
+		if err := b.DB.FinishJob(jobID, "failed", "", ""); err != nil {
+			lg.Error("failed to record job result", "job_id", jobID, "err", err)
+		}
+		if errors.Is(err, database.ErrInsufficientCredits) {
+			return 0, false, text
+		}
+		lg.Error("failed to spend credits", "err", err)
+		return 0, false, b.Localizer.Get(lang, "error_generic")
+	}
+	lg.Info("credits spent", "job_id", jobID, "credits", cost)
+	return jobID, true, ""
+}
+
+// jobRef adalah ref entri ledger untuk kredit yang dipakai job.
+func jobRef(jobID int64) string {
+	return strconv.FormatInt(jobID, 10)
+}
+
+func (b *Bot) formatResetTime(t time.Time) string {
+	return t.In(b.quotaLoc).Format("2006-01-02 15:04 MST")
+}
+
+// showQuota menjawab perintah /quota.
+func (b *Bot) showQuota(lg *slog.Logger, chatID int64, userID int64, lang string) {
+	tier := b.userTier(userID)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(b.Localizer.Get(lang, "quota_title"), tier))
+	for _, kind := range quotaKinds {
+		status, err := b.quotaStatus(userID, tier, kind)
+		if err != nil {
+			b.storeFailed(lg, chatID, lang, err)
+			return
+		}
+		name := b.Localizer.Get(lang, "quota_kind_"+kind)
+		if !status.Limited {
+			sb.WriteString(fmt.Sprintf(b.Localizer.Get(lang, "quota_unlimited"), name))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf(b.Localizer.Get(lang, "quota_line"), name, status.Left(), status.Limit.Limit,
+			b.Localizer.Get(lang, "quota_period_"+status.Limit.Period), b.formatResetTime(status.ResetAt)))
+	}
+	balance, err := b.DB.GetCreditBalance(userID)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	sb.WriteString(fmt.Sprintf(b.Localizer.Get(lang, "quota_credits"), balance))
+	b.sendMessage(chatID, sb.String())
+}
+
+// handleSetTier menangani perintah admin "/settier <user_id> <tier>".
+func (b *Bot) handleSetTier(lg *slog.Logger, chatID int64, text string, lang string) {
+	fields := strings.Fields(text)
+	if len(fields) != 3 {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "settier_usage"))
+		return
+	}
+	targetID, err := strconv.ParseInt(fields[1], 10, 64)
+	tier := fields[2]
+	_, configured := b.Cfg.Quotas[tier]
+	if err != nil || targetID <= 0 || (!configured && tier != unlimitedTier) {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "settier_usage"))
+		return
+	}
+
+	if err := b.DB.SetUserTier(targetID, tier); err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	lg.Info("user tier changed", "target_user_id", targetID, "tier", tier)
+	b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "settier_done"), targetID, tier))
+}
@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestQuotaPeriod(t *testing.T) {
+	const layout = "2006-01-02 15:04 MST"
+	cases := []struct {
+		name   string
+		tz     string
+		now    string // UTC
+		period string
+		start  string // di zona waktu tz
+		next   string
+		length time.Duration
+	}{
+		{"day", "UTC", "2026-03-04 15:00", "day",
+			"2026-03-04 00:00 UTC", "2026-03-05 00:00 UTC", 24 * time.Hour},
+		// 20:00 UTC sudah tanggal 5 di Jakarta.
+		{"day ahead of UTC", "Asia/Jakarta", "2026-03-04 20:00", "day",
+			"2026-03-05 00:00 WIB", "2026-03-06 00:00 WIB", 24 * time.Hour},
+		// 02:00 UTC masih tanggal 3 di New York.
+		{"day behind UTC", "America/New_York", "2026-03-04 02:00", "day",
+			"2026-03-03 00:00 EST", "2026-03-04 00:00 EST", 24 * time.Hour},
+		{"day at midnight", "UTC", "2026-03-04 00:00", "day",
+			"2026-03-04 00:00 UTC", "2026-03-05 00:00 UTC", 24 * time.Hour},
+		// Jam maju: 8 Maret 2026 hanya 23 jam di New York.
+		{"day DST start", "America/New_York", "2026-03-08 12:00", "day",
+			"2026-03-08 00:00 EST", "2026-03-09 00:00 EDT", 23 * time.Hour},
+		// Jam mundur: 1 November 2026 panjangnya 25 jam.
+		{"day DST end", "America/New_York", "2026-11-01 12:00", "day",
+			"2026-11-01 00:00 EDT", "2026-11-02 00:00 EST", 25 * time.Hour},
+		// Minggu mulai Senin; Minggu malam masih minggu yang sama.
+		{"week on Sunday", "UTC", "2026-03-08 23:59", "week",
+			"2026-03-02 00:00 UTC", "2026-03-09 00:00 UTC", 7 * 24 * time.Hour},
+		{"week on Monday", "UTC", "2026-03-09 00:00", "week",
+			"2026-03-09 00:00 UTC", "2026-03-16 00:00 UTC", 7 * 24 * time.Hour},
+		// Senin 00:30 di Jakarta masih Minggu sore di UTC.
+		{"week ahead of UTC", "Asia/Jakarta", "2026-03-08 17:30", "week",
+			"2026-03-09 00:00 WIB", "2026-03-16 00:00 WIB", 7 * 24 * time.Hour},
+		{"week DST start", "America/New_York", "2026-03-06 12:00", "week",
+			"2026-03-02 00:00 EST", "2026-03-09 00:00 EDT", 7*24*time.Hour - time.Hour},
+		{"week DST end", "America/New_York", "2026-10-28 12:00", "week",
+			"2026-10-26 00:00 EDT", "2026-11-02 00:00 EST", 7*24*time.Hour + time.Hour},
+		{"month", "UTC", "2026-01-31 23:00", "month",
+			"2026-01-01 00:00 UTC", "2026-02-01 00:00 UTC", 31 * 24 * time.Hour},
+		{"month year end", "Asia/Jakarta", "2026-12-31 17:00", "month",
+			"2027-01-01 00:00 WIB", "2027-02-01 00:00 WIB", 31 * 24 * time.Hour},
+		{"month DST start", "America/New_York", "2026-03-15 12:00", "month",
+			"2026-03-01 00:00 EST", "2026-04-01 00:00 EDT", 31*24*time.Hour - time.Hour},
+		// Periode yang tidak dikenal diperlakukan sebagai harian.
+		{"unknown period", "UTC", "2026-03-04 15:00", "",
+			"2026-03-04 00:00 UTC", "2026-03-05 00:00 UTC", 24 * time.Hour},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(c.tz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now, err := time.Parse("2006-01-02 15:04", c.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start, next := quotaPeriod(now, loc, c.period)
+			if got := start.In(loc).Format(layout); got != c.start {
+				t.Errorf("start = %s, want %s", got, c.start)
+			}
+			if got := next.In(loc).Format(layout); got != c.next {
+				t.Errorf("next = %s, want %s", got, c.next)
+			}
+			if got := next.Sub(start); got != c.length {
+				t.Errorf("period length = %v, want %v", got, c.length)
+			}
+			if now.Before(start) || !now.Before(next) {
+				t.Errorf("now %v outside [%v, %v)", now, start, next)
+			}
+		})
+	}
+}
+
+func TestFormatResetTime(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Bot{quotaLoc: loc}
+	_, next := quotaPeriod(time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC), loc, "day")
+	if got, want := b.formatResetTime(next), "2026-03-09 00:00 EDT"; got != want {
+		t.Fatalf("reset time = %q, want %q", got, want)
+	}
+	// Waktu reset ditampilkan di zona kuota, bukan zona server.
+	if got, want := b.formatResetTime(next.UTC()), "2026-03-09 00:00 EDT"; got != want {
+		t.Fatalf("reset time from UTC = %q, want %q", got, want)
+	}
+}
+
+// Job yang tidak menghasilkan apa-apa tidak dihitung ke kuota.
+func TestFinishJobQuota(t *testing.T) {
+	cases := []struct {
+		status  string
+		counted int
+	}{
+		{"success", 1},
+		{"failed", 0},
+		{"timeout", 0},
+		{"canceled", 0},
+	}
+	for _, c := range cases {
+		t.Run(c.status, func(t *testing.T) {
+			b, _ := newTestBot(t)
+			const userID = int64(500)
+			since := time.Now().Add(-time.Minute)
+			jobID, err := b.DB.CreateJob(userID, userID, "nano-banana", "image", "a cat")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b.finishJob(jobID, "nano-banana", c.status, "", "")
+
+			n, err := b.DB.CountJobsSince(userID, "image", since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != c.counted {
+				t.Fatalf("counted jobs = %d, want %d", n, c.counted)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"kieAITelegram/internal/models"
+)
+
+// Kode referral di deep link t.me/<bot>?start=ref_<user_id>.
+const referralPrefix = "ref_"
+
+func referralCode(userID int64) string {
+	return referralPrefix + strconv.FormatInt(userID, 10)
+}
+
+func parseReferralCode(payload string) (int64, bool) {
+	if !strings.HasPrefix(payload, referralPrefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(payload, referralPrefix), 10, 64)
+	return id, err == nil && id > 0
+}
+
+// handleStartPayload menangani parameter "/start <payload>" dari deep link.
+// Payload yang tidak dikenal diabaikan.
+func (b *Bot) handleStartPayload(lg *slog.Logger, chatID int64, userID int64, payload string, lang string) {
+	referrerID, ok := parseReferralCode(payload)
+	if !ok {
+		lg.Debug("unknown start payload", "payload", payload)
+		return
+	}
+	applied, err := b.DB.SetReferrer(userID, referrerID)
+	if err != nil {
+		lg.Error("failed to record referral", "referrer_id", referrerID, "err", err)
+		return
+	}
+	if !applied {
+		lg.Info("referral ignored", "referrer_id", referrerID)
+		return
+	}
+	lg.Info("referral recorded", "referrer_id", referrerID)
+	if b.Cfg.ReferralBonus > 0 {
+		b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "referral_welcome"), b.Cfg.ReferralBonus))
+	}
+}
+
+// rewardReferral memberi bonus referral setelah generate pertama user yang
+// berhasil. Pesan dikirim ke chat pribadi (chat ID = user ID).
+func (b *Bot) rewardReferral(jobID int64) {
+	if jobID == 0 {
+		return
+	}
+	job, err := b.DB.GetJob(jobID)
+	if err != nil {
+		b.Log.Error("failed to read job for referral", "job_id", jobID, "err", err)
+		return
+	}
+	referrerID, err := b.DB.RewardReferral(job.UserID, b.Cfg.ReferralBonus)
+	if err != nil {
+		b.Log.Error("failed to reward referral", "user_id", job.UserID, "err", err)
+		return
+	}
+	if referrerID == 0 {
+		return
+	}
+	b.Log.Info("referral rewarded", "user_id", job.UserID, "referrer_id", referrerID, "credits", b.Cfg.ReferralBonus)
+	if b.Cfg.ReferralBonus <= 0 {
+		return
+	}
+	b.sendMessage(job.UserID, fmt.Sprintf(b.Localizer.Get(b.userLang(job.UserID), "referral_bonus_invitee"), b.Cfg.ReferralBonus))
+	b.sendMessage(referrerID, fmt.Sprintf(b.Localizer.Get(b.userLang(referrerID), "referral_bonus_referrer"), b.Cfg.ReferralBonus))
+}
+
+// botUsername mengambil username bot lewat getMe sekali, lalu disimpan.
+func (b *Bot) botUsername() (string, error) {
+	b.mu.Lock()
+	name := b.username
+	b.mu.Unlock()
+	if name != "" {
+		return name, nil
+	}
+
+	result, err := b.out.Call("getMe", 0, struct{}{})
+	if err != nil {
+		return "", err
+	}
+	var me models.User
+	if err := json.Unmarshal(result, &me); err != nil {
+		return "", err
+	}
+	if me.Username == "" {
+		return "", fmt.Errorf("getMe returned no username")
+	}
+	b.mu.Lock()
+	b.username = me.Username
+	b.mu.Unlock()
+	return me.Username, nil
+}
+
+// showInvite menjawab perintah /invite: link undangan dan statistiknya.
+func (b *Bot) showInvite(lg *slog.Logger, chatID int64, userID int64, lang string) {
+	username, err := b.botUsername()
+	if err != nil {
+		lg.Error("failed to get bot username", "err", err)
+		b.sendMessage(chatID, b.Localizer.Get(lang, "error_generic"))
+		return
+	}
+	stats, err := b.DB.GetReferralStats(userID)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+
+	link := fmt.Sprintf("https://t.me/%s?start=%s", username, referralCode(userID))
+	text := fmt.Sprintf(b.Localizer.Get(lang, "invite_text"), link)
+	if b.Cfg.ReferralBonus > 0 {
+		text += fmt.Sprintf(b.Localizer.Get(lang, "invite_bonus"), b.Cfg.ReferralBonus)
+	}
+	text += fmt.Sprintf(b.Localizer.Get(lang, "invite_stats"), stats.Invited, stats.Rewarded, stats.Credits)
+	b.sendMessage(chatID, text)
+}
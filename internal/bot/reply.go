@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+
+	"kieAITelegram/internal/core"
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/models"
+)
+
+// handleReplyEdit starts an edit job when the user replies to one of their
+// image results with instructions. The result becomes the image_input of
+// EDIT_DEFAULT_MODEL; the user's current model and draft are left alone. It
+// returns false when msg is not a reply to a known result, so the message is
+// handled as usual.
+func (b *Bot) handleReplyEdit(lg *slog.Logger, msg *models.TelegramMessage, text string, lang string) bool {
+	reply := msg.ReplyToMessage
+	if b.Cfg.EditDefaultModel == "" || reply == nil || text == "" || strings.HasPrefix(text, "/") {
+		return false
+	}
+	chatID := msg.Chat.ID
+	userID := msg.From.ID
+
+	job, err := b.DB.GetJobByMessage(chatID, reply.MessageID)
+	if errors.Is(err, database.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return true
+	}
+	// Di grup, hanya pemilik hasil yang bisa mengeditnya.
+	if job.UserID != userID {
+		return false
+	}
+	if job.Kind != "image" || job.ResultURL == "" {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "reply_edit_unavailable"))
+		return true
+	}
+	model := core.GetModelByID(b.Cfg.EditDefaultModel)
+	if model == nil {
+		b.sendMessage(chatID, b.Localizer.Get(lang, "error_model_not_found"))
+		return true
+	}
+
+	options := map[string]interface{}{
+		"image_input": []string{b.resultLink(resultSource{URL: job.ResultURL, Name: job.MediaName})},
+	}
+	width, height := photoSize(reply)
+	if ratio := ratioForImage(model, width, height); ratio != "" {
+		options["ratio"] = ratio
+	}
+	if len(model.Formats) > 0 {
+		options["format"] = model.Formats[0]
+	}
+
+	// Instruksi edit dipakai apa adanya, tanpa prompt enhancer.
+	lg.Info("editing result from reply", "source_job", job.ID, "model", model.ID)
+	state := database.UserState{State: "WAITING_PROMPT", SelectedModel: model.ID, DraftOptions: options}
+	b.processImageGeneration(lg, chatID, userID, text, state, lang)
+	return true
+}
+
+// photoSize returns the dimensions of the largest photo in msg, or zeros when
+// msg has no photo (e.g. a result sent as a document).
+func photoSize(msg *models.TelegramMessage) (int, int) {
+	if len(msg.Photo) == 0 {
+		return 0, 0
+	}
+	p := msg.Photo[len(msg.Photo)-1]
+	return p.Width, p.Height
+}
+
+// Selisih rasio (log lebar/tinggi) yang masih dianggap cocok, kira-kira 16%.
+const ratioTolerance = 0.15
+
+// ratioForImage picks the model ratio closest to a width x height image. When
+// the dimensions are unknown or no ratio is close enough it falls back to the
+// model's "auto" ratio, if any, and otherwise to "" to keep the default.
+func ratioForImage(model *core.AIModel, width int, height int) string {
+	auto := ""
+	for _, r := range model.Ratios {
+		if strings.EqualFold(r, "auto") {
+			auto = r
+		}
+	}
+	if width <= 0 || height <= 0 {
+		return auto
+	}
+
+	target := math.Log(float64(width) / float64(height))
+	best, bestDiff := "", math.Inf(1)
+	for _, r := range model.Ratios {
+		v, ok := parseRatio(r)
+		if !ok {
+			continue
+		}
+		if diff := math.Abs(math.Log(v) - target); diff < bestDiff {
+			best, bestDiff = r, diff
+		}
+	}
+	if auto != "" && bestDiff > ratioTolerance {
+		return auto
+	}
+	return best
+}
+
+// parseRatio mengubah "16:9" atau nama ukuran Qwen seperti "portrait_4_3"
+// menjadi lebar/tinggi.
+func parseRatio(r string) (float64, bool) {
+	switch {
+	case strings.HasPrefix(r, "square"):
+		return 1, true
+	case strings.HasPrefix(r, "portrait_"):
+		v, ok := parseRatioParts(strings.Split(strings.TrimPrefix(r, "portrait_"), "_"))
+		return 1 / v, ok
+	case strings.HasPrefix(r, "landscape_"):
+		return parseRatioParts(strings.Split(strings.TrimPrefix(r, "landscape_"), "_"))
+	}
+	return parseRatioParts(strings.Split(r, ":"))
+}
+
+func parseRatioParts(parts []string) (float64, bool) {
+	if len(parts) != 2 {
+		return 0, false
+	}
+	w, err1 := strconv.ParseFloat(parts[0], 64)
+	h, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return 0, false
+	}
+	return w / h, true
+}
@@ -0,0 +1,316 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"kieAITelegram/internal/metrics"
+)
+
+// Batas kirim Bot API (lihat FAQ Telegram): sekitar 30 pesan/detik total,
+// 1 pesan/detik per chat pribadi, dan 20 pesan/menit per grup.
+const (
+	globalSendRate  = 30
+	globalSendBurst = 30
+	chatSendRate    = 1
+	chatSendBurst   = 3
+	groupSendRate   = 20.0 / 60
+	groupSendBurst  = 3
+
+	// Berapa kali request yang kena 429 dicoba ulang sebelum menyerah.
+	maxRateLimitRetries = 3
+	// Batas waktu menunggu giliran kirim; lebih dari ini request dibatalkan.
+	maxSendWait = 2 * time.Minute
+	// Status "typing/uploading" tampil sekitar 5 detik, jadi job yang sedang
+	// berjalan mengirim ulang setiap chatActionInterval, terlepas dari
+	// POLL_INTERVAL. Action yang sama ke chat yang sama dalam chatActionTTL
+	// (misal dari beberapa job sekaligus) digabung menjadi satu; TTL harus
+	// lebih pendek dari interval supaya kiriman ulang sebuah job tidak ikut
+	// dibuang.
+	chatActionInterval = 4 * time.Second
+	chatActionTTL      = 3 * time.Second
+)
+
+// APIError is a request the Bot API answered with ok=false.
+type APIError struct {
+	Method      string
+	Code        int
+	Description string
+	// RetryAfter diisi untuk error 429 (dalam detik).
+	RetryAfter int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram %s: %d %s", e.Method, e.Code, e.Description)
+}
+
+// IsRetryable reports whether the request may succeed later unchanged.
+func (e *APIError) IsRetryable() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+type apiResponse struct {
+	Ok          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// tokenBucket membatasi laju kirim. pause dipakai untuk menghormati
+// retry_after dari Telegram: selama jeda tidak ada token yang diberikan.
+type tokenBucket struct {
+	mu          sync.Mutex
+	rate        float64 // token per detik
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// reserve mengambil satu token jika ada, atau mengembalikan lama waktu
+// sampai token berikutnya tersedia.
+func (tb *tokenBucket) reserve(now time.Time) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if now.Before(tb.pausedUntil) {
+		return tb.pausedUntil.Sub(now)
+	}
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+func (tb *tokenBucket) wait(ctx context.Context) error {
+	for {
+		d := tb.reserve(time.Now())
+		if d == 0 {
+			return nil
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (tb *tokenBucket) pause(d time.Duration) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if until := time.Now().Add(d); until.After(tb.pausedUntil) {
+		tb.pausedUntil = until
+	}
+}
+
+// idle true jika bucket sudah penuh kembali, jadi aman dibuang dari map.
+func (tb *tokenBucket) idle(now time.Time) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	full := tb.tokens+now.Sub(tb.last).Seconds()*tb.rate >= tb.burst
+	return full && now.After(tb.pausedUntil)
+}
+
+type chatActionKey struct {
+	chatID int64
+	action string
+}
+
+// sender mengirim semua request Bot API dengan batas per chat dan global.
+// Setiap pemanggil menunggu gilirannya sendiri, jadi urutan kirim dalam satu
+// chat tetap sama dengan urutan pemanggilan.
+type sender struct {
+	apiURL string
+	client *http.Client
+	global *tokenBucket
+
+	mu      sync.Mutex
+	chats   map[int64]*tokenBucket
+	actions map[chatActionKey]time.Time
+}
+
+func newSender(apiURL string) *sender {
+	return &sender{
+		apiURL:  apiURL,
+		client:  &http.Client{Timeout: 60 * time.Second},
+		global:  newTokenBucket(globalSendRate, globalSendBurst),
+		chats:   make(map[int64]*tokenBucket),
+		actions: make(map[chatActionKey]time.Time),
+	}
+}
+
+func (s *sender) chatBucket(chatID int64) *tokenBucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tb, ok := s.chats[chatID]
+	if !ok {
+		if len(s.chats) >= 10000 {
+			s.sweepLocked(time.Now())
+		}
+		// Chat ID negatif adalah grup/channel, batasnya lebih ketat.
+		if chatID < 0 {
+			tb = newTokenBucket(groupSendRate, groupSendBurst)
+		} else {
+			tb = newTokenBucket(chatSendRate, chatSendBurst)
+		}
+		s.chats[chatID] = tb
+	}
+	return tb
+}
+
+func (s *sender) sweepLocked(now time.Time) {
+	for id, tb := range s.chats {
+		if tb.idle(now) {
+			delete(s.chats, id)
+		}
+	}
+	for key, at := range s.actions {
+		if now.Sub(at) > chatActionTTL {
+			delete(s.actions, key)
+		}
+	}
+}
+
+// wait menunggu giliran kirim untuk chatID (0 = tidak terikat chat, misal
+// answerCallbackQuery atau pesan inline).
+func (s *sender) wait(ctx context.Context, chatID int64) error {
+	if chatID != 0 {
+		if err := s.chatBucket(chatID).wait(ctx); err != nil {
+			return err
+		}
+	}
+	return s.global.wait(ctx)
+}
+
+// rateLimited menjeda chat (atau semua request, jika tidak terikat chat)
+// selama retry_after.
+func (s *sender) rateLimited(method string, chatID int64, retryAfter int) {
+	metrics.TelegramRateLimitedTotal.Inc(method)
+	d := time.Duration(retryAfter) * time.Second
+	if chatID != 0 {
+		s.chatBucket(chatID).pause(d)
+	} else {
+		s.global.pause(d)
+	}
+}
+
+// shouldSendAction false jika action yang sama baru saja dikirim ke chat ini.
+func (s *sender) shouldSendAction(chatID int64, action string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := chatActionKey{chatID, action}
+	now := time.Now()
+	if len(s.actions) >= 10000 {
+		s.sweepLocked(now)
+	}
+	if at, ok := s.actions[key]; ok && now.Sub(at) < chatActionTTL {
+		return false
+	}
+	s.actions[key] = now
+	return true
+}
+
+// Call sends a JSON request to method and returns its result. Requests wait
+// for the chat's and the global rate limit, and 429 answers are retried after
+// the retry_after Telegram asks for. Every other failure is returned.
+func (s *sender) Call(method string, chatID int64, data interface{}) (json.RawMessage, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), maxSendWait)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		if err := s.wait(ctx, chatID); err != nil {
+			return nil, fmt.Errorf("telegram %s: waiting for rate limit: %w", method, err)
+		}
+
+		result, err := s.post(method, "application/json", bytes.NewReader(body), s.client)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusTooManyRequests {
+			s.rateLimited(method, chatID, apiErr.RetryAfter)
+			if attempt < maxRateLimitRetries {
+				continue
+			}
+		}
+		return result, err
+	}
+}
+
+// Upload sends a request whose body can only be read once (multipart
+// upload). It waits for the rate limit like Call, but a 429 is not retried:
+// the chat is paused and the error is returned to the caller.
+func (s *sender) Upload(method string, chatID int64, contentType string, body io.Reader, timeout time.Duration) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), maxSendWait)
+	defer cancel()
+	if err := s.wait(ctx, chatID); err != nil {
+		return nil, fmt.Errorf("telegram %s: waiting for rate limit: %w", method, err)
+	}
+
+	result, err := s.post(method, contentType, body, &http.Client{Timeout: timeout})
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusTooManyRequests {
+		s.rateLimited(method, chatID, apiErr.RetryAfter)
+	}
+	return result, err
+}
+
+func (s *sender) post(method string, contentType string, body io.Reader, client *http.Client) (json.RawMessage, error) {
+	resp, err := client.Post(s.apiURL+"/"+method, contentType, body)
+	if err != nil {
+		// url.Error menyertakan URL yang berisi token bot; buang URL-nya.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("telegram %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var result apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("telegram %s: status %d: %v", method, resp.StatusCode, err)
+	}
+	if !result.Ok {
+		code := result.ErrorCode
+		if code == 0 {
+			code = resp.StatusCode
+		}
+		return nil, &APIError{
+			Method:      method,
+			Code:        code,
+			Description: result.Description,
+			RetryAfter:  result.Parameters.RetryAfter,
+		}
+	}
+	return result.Result, nil
+}
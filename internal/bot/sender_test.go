@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBurstAndRefill(t *testing.T) {
+	tb := newTokenBucket(2, 3)
+	now := tb.last
+
+	for i := 0; i < 3; i++ {
+		if d := tb.reserve(now); d != 0 {
+			t.Fatalf("token %d: wait %v, want none within burst", i, d)
+		}
+	}
+	if d := tb.reserve(now); d != 500*time.Millisecond {
+		t.Fatalf("empty bucket: wait %v, want 500ms at 2/s", d)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if d := tb.reserve(now); d != 0 {
+		t.Fatalf("after refill: wait %v, want none", d)
+	}
+	// Bucket tidak terisi melebihi burst meski lama idle.
+	now = now.Add(time.Hour)
+	if !tb.idle(now) {
+		t.Fatal("bucket should be idle after an hour")
+	}
+	for i := 0; i < 3; i++ {
+		tb.reserve(now)
+	}
+	if d := tb.reserve(now); d == 0 {
+		t.Fatal("bucket refilled past its burst")
+	}
+}
+
+func TestTokenBucketPause(t *testing.T) {
+	tb := newTokenBucket(10, 10)
+	tb.pause(time.Minute)
+	now := time.Now()
+	if d := tb.reserve(now); d < 59*time.Second {
+		t.Fatalf("paused bucket: wait %v, want about a minute", d)
+	}
+	// Jeda yang lebih pendek tidak memperpendek jeda yang sedang berjalan.
+	tb.pause(time.Second)
+	if d := tb.reserve(now); d < 59*time.Second {
+		t.Fatalf("shorter pause replaced longer one: wait %v", d)
+	}
+	if tb.idle(now) {
+		t.Fatal("paused bucket reported idle")
+	}
+	if d := tb.reserve(now.Add(time.Minute + time.Second)); d != 0 {
+		t.Fatalf("after pause: wait %v, want none", d)
+	}
+}
+
+// rateLimitedServer menjawab 429 dengan retry_after untuk `limited` request
+// pertama, lalu sukses.
+func rateLimitedServer(t *testing.T, limited int32, retryAfter int) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= limited {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintf(w, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after %d","parameters":{"retry_after":%d}}`, retryAfter, retryAfter)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":1}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestSenderRetriesAfterRateLimit(t *testing.T) {
+	srv, calls := rateLimitedServer(t, 1, 1)
+	s := newSender(srv.URL)
+
+	start := time.Now()
+	result, err := s.Call("sendMessage", 42, map[string]string{"text": "hi"})
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if string(result) != `{"message_id":1}` {
+		t.Fatalf("result = %s", result)
+	}
+	if n := atomic.LoadInt32(calls); n != 2 {
+		t.Fatalf("server saw %d requests, want 2", n)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Fatalf("retried after %v, want at least retry_after (1s)", waited)
+	}
+
+	// Chat lain tidak ikut dijeda.
+	if d := s.chatBucket(43).reserve(time.Now()); d != 0 {
+		t.Fatalf("other chat waits %v", d)
+	}
+}
+
+func TestSenderGivesUpAfterMaxRetries(t *testing.T) {
+	srv, calls := rateLimitedServer(t, 100, 0)
+	s := newSender(srv.URL)
+
+	_, err := s.Call("answerCallbackQuery", 0, map[string]string{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("got %v, want a 429 APIError", err)
+	}
+	if n := atomic.LoadInt32(calls); n != maxRateLimitRetries+1 {
+		t.Fatalf("server saw %d requests, want %d", n, maxRateLimitRetries+1)
+	}
+}
+
+func TestSenderUploadDoesNotRetry(t *testing.T) {
+	srv, calls := rateLimitedServer(t, 1, 30)
+	s := newSender(srv.URL)
+
+	_, err := s.Upload("sendPhoto", 42, "multipart/form-data", http.NoBody, time.Second)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter != 30 {
+		t.Fatalf("got %v, want a 429 APIError with retry_after 30", err)
+	}
+	if n := atomic.LoadInt32(calls); n != 1 {
+		t.Fatalf("server saw %d requests, want 1", n)
+	}
+	// Chat dijeda selama retry_after supaya kiriman berikutnya ikut menunggu.
+	if d := s.chatBucket(42).reserve(time.Now()); d < 29*time.Second {
+		t.Fatalf("chat waits %v after 429, want about 30s", d)
+	}
+}
+
+func TestSenderMergesChatActions(t *testing.T) {
+	s := newSender("")
+	if !s.shouldSendAction(1, "typing") {
+		t.Fatal("first action skipped")
+	}
+	if s.shouldSendAction(1, "typing") {
+		t.Fatal("repeated action not merged")
+	}
+	if !s.shouldSendAction(1, "upload_photo") || !s.shouldSendAction(2, "typing") {
+		t.Fatal("different action or chat merged")
+	}
+	// Kiriman ulang dari job yang sama tidak boleh dibuang.
+	s.actions[chatActionKey{1, "typing"}] = time.Now().Add(-chatActionInterval)
+	if !s.shouldSendAction(1, "typing") {
+		t.Fatal("keep-alive re-send was merged")
+	}
+}
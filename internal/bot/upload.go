@@ -0,0 +1,193 @@
+package bot
+
+import (
+	"fmt"
+	"kieAITelegram/internal/database"
+	"kieAITelegram/internal/models"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// Batas ukuran file input (Bot API getFile hanya bisa sampai 20 MB).
+	maxImageUploadBytes = 20 * 1024 * 1024
+
+	// Waktu tunggu sampai semua item album (media group) diterima.
+	mediaGroupDelay = 1500 * time.Millisecond
+)
+
+var allowedImageMIME = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// pendingMediaGroup mengumpulkan semua foto dari satu album sebelum disimpan.
+type pendingMediaGroup struct {
+	chatID  int64
+	userID  int64
+	lang    string
+	log     *slog.Logger
+	fileIDs []string
+	timer   *time.Timer
+}
+
+func (b *Bot) handleImageUpload(lg *slog.Logger, msg *models.TelegramMessage) {
+	chatID := msg.Chat.ID
+	userID := msg.From.ID
+	lang := b.userLang(userID)
+	state, err := b.DB.GetUserState(userID)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+
+	if state.State != "WAITING_IMAGE_UPLOAD" {
+		return
+	}
+
+	fileID, errKey := imageFileID(msg)
+	if errKey != "" {
+		if errKey == "upload_unsupported_type" {
+			b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, errKey), msg.Document.MimeType))
+		} else {
+			b.sendMessage(chatID, b.Localizer.Get(lang, errKey))
+		}
+		return
+	}
+
+	if msg.MediaGroupID == "" {
+		b.addImageInputs(lg, chatID, userID, lang, []string{fileID})
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	group, exists := b.mediaGroups[msg.MediaGroupID]
+	if !exists {
+		group = &pendingMediaGroup{chatID: chatID, userID: userID, lang: lang, log: lg.With("media_group_id", msg.MediaGroupID)}
+		groupID := msg.MediaGroupID
+		group.timer = time.AfterFunc(mediaGroupDelay, func() {
+			b.flushMediaGroup(groupID)
+		})
+		b.mediaGroups[groupID] = group
+	} else {
+		group.timer.Reset(mediaGroupDelay)
+	}
+	group.fileIDs = append(group.fileIDs, fileID)
+}
+
+// imageFileID memilih file_id dari foto atau dokumen gambar, atau mengembalikan
+// key locale untuk pesan error jika file tidak valid.
+func imageFileID(msg *models.TelegramMessage) (string, string) {
+	if len(msg.Photo) > 0 {
+		bestPhoto := msg.Photo[len(msg.Photo)-1]
+		if bestPhoto.FileSize > maxImageUploadBytes {
+			return "", "upload_too_large"
+		}
+		return bestPhoto.FileID, ""
+	}
+
+	doc := msg.Document
+	mime := strings.ToLower(doc.MimeType)
+	if !allowedImageMIME[mime] {
+		return "", "upload_unsupported_type"
+	}
+	if doc.FileSize > maxImageUploadBytes {
+		return "", "upload_too_large"
+	}
+	return doc.FileID, ""
+}
+
+func (b *Bot) flushMediaGroup(groupID string) {
+	b.mu.Lock()
+	group, exists := b.mediaGroups[groupID]
+	delete(b.mediaGroups, groupID)
+	b.mu.Unlock()
+
+	if exists {
+		b.addImageInputs(group.log, group.chatID, group.userID, group.lang, group.fileIDs)
+	}
+}
+
+// addImageInputs menambahkan beberapa gambar ke draft sekaligus dan mengirim satu konfirmasi.
+func (b *Bot) addImageInputs(lg *slog.Logger, chatID int64, userID int64, lang string, fileIDs []string) {
+	state, err := b.DB.GetUserState(userID)
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+	imageList := draftImageList(state.DraftOptions)
+
+	maxImages := b.limitsFor(state.SelectedModel).MaxImages
+	if len(imageList) >= maxImages {
+		b.sendMessage(chatID, fmt.Sprintf(b.Localizer.Get(lang, "upload_max_limit"), maxImages))
+		return
+	}
+
+	skipped := 0
+	var uploaded []string
+	for _, fileID := range fileIDs {
+		if len(imageList)+len(uploaded) >= maxImages {
+			skipped++
+			continue
+		}
+
+		fileURL, err := b.rehostTelegramFile(fileID)
+		if err != nil {
+			lg.Error("failed to re-host uploaded file", "err", err)
+			b.sendMessage(chatID, b.Localizer.Get(lang, "upload_fail_url"))
+			continue
+		}
+		uploaded = append(uploaded, fileURL)
+	}
+
+	// Upload lain bisa masuk selama re-host, jadi append dan cek limit
+	// dilakukan ulang pada state terbaru di dalam transaksi.
+	total := 0
+	err = b.DB.UpdateUserState(userID, func(state *database.UserState) error {
+		current := draftImageList(state.DraftOptions)
+		room := maxImages - len(current)
+		if room < 0 {
+			room = 0
+		}
+		added := uploaded
+		if len(added) > room {
+			skipped += len(added) - room
+			added = added[:room]
+		}
+		current = append(current, added...)
+		state.DraftOptions["image_input"] = current
+		total = len(current)
+		return nil
+	})
+	if err != nil {
+		b.storeFailed(lg, chatID, lang, err)
+		return
+	}
+
+	msgText := fmt.Sprintf(b.Localizer.Get(lang, "upload_received"), total, maxImages)
+	if skipped > 0 {
+		msgText += "\n\n" + fmt.Sprintf(b.Localizer.Get(lang, "upload_max_limit"), maxImages)
+	}
+	b.sendMessage(chatID, msgText)
+}
+
+func draftImageList(opts map[string]interface{}) []string {
+	var imageList []string
+
+	if existing, ok := opts["image_input"]; ok {
+		if listInterface, ok := existing.([]interface{}); ok {
+			for _, item := range listInterface {
+				if str, ok := item.(string); ok {
+					imageList = append(imageList, str)
+				}
+			}
+		} else if listString, ok := existing.([]string); ok {
+			imageList = listString
+		}
+	}
+	return imageList
+}
@@ -2,47 +2,578 @@ package config
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"kieAITelegram/internal/models"
-	"log"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func LoadConfig() (*models.Config, error) {
-	file, err := os.Open(".env")
+// Urutan prioritas konfigurasi (yang belakang menimpa yang depan):
+// default -> file config JSON -> environment (.env, lalu env asli) -> flag command-line.
+
+func Defaults() *models.Config {
+	return &models.Config{
+		TelegramAPIURL:     "https://api.telegram.org",
+		DBDriver:           "sqlite",
+		DBPath:             "./kieAITelegram.db",
+		DefaultLang:        "en",
+		ModelsPath:         "models.json",
+		LocalesDir:         "locales",
+		PollInterval:       3 * time.Second,
+		TaskTimeout:        5 * time.Minute,
+		MaxImageInputs:     8,
+		CaptionPromptMax:   300,
+		InlineDefaultModel: "nano-banana",
+		EditDefaultModel:   "nano-banana-edit",
+		AnimateModel:       "veo-3-fast",
+		QuotaTimezone:      "UTC",
+		CreditCosts:        map[string]int{"image": 1, "video": 5},
+		ReferralBonus:      5,
+		UpdateWorkers:      16,
+		UpdateQueueSize:    256,
+		KieHTTPTimeout:     60 * time.Second,
+		UploadTimeout:      120 * time.Second,
+		MediaDir:           "./media",
+		MediaRetention:     72 * time.Hour,
+		MediaLinkTTL:       24 * time.Hour,
+		LogLevel:           "info",
+		LogFormat:          "text",
+
+		ModerationHookTimeout:  5 * time.Second,
+		ModerationStrikes:      3,
+		ModerationStrikeWindow: 24 * time.Hour,
+		ModerationBanDuration:  24 * time.Hour,
+
+		EnhanceTimeout: 20 * time.Second,
+	}
+}
+
+// setting adalah satu nilai konfigurasi. Nama env dipakai sebagai dasar untuk
+// key di file config (huruf kecil) dan nama flag (huruf kecil, "_" jadi "-").
+type setting struct {
+	Env   string
+	Usage string
+	set   func(value string) error
+}
+
+func (s setting) fileKey() string {
+	return strings.ToLower(s.Env)
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.Env), "_", "-")
+}
+
+func settings(c *models.Config) []setting {
+	return []setting{
+		{"TELEGRAM_BOT_TOKEN", "Telegram bot token from @BotFather", stringVar(&c.TelegramToken)},
+		{"TELEGRAM_API_URL", "Bot API base URL, e.g. a local Bot API server", stringVar(&c.TelegramAPIURL)},
+		{"KIE_API_KEY", "Kie.ai API key", stringVar(&c.KieAPIKey)},
+		{"DB_DRIVER", "database driver: sqlite or postgres", stringVar(&c.DBDriver)},
+		{"DB_PATH", "SQLite database path", stringVar(&c.DBPath)},
+		{"DATABASE_URL", "PostgreSQL connection URL (DB_DRIVER=postgres)", stringVar(&c.DatabaseURL)},
+		{"DEFAULT_LANG", "default language code", stringVar(&c.DefaultLang)},
+		{"MODELS_PATH", "path to models.json", stringVar(&c.ModelsPath)},
+		{"LOCALES_DIR", "directory with locale JSON files", stringVar(&c.LocalesDir)},
+		{"ADMIN_IDS", "comma-separated Telegram user IDs with admin access", int64ListVar(&c.AdminIDs)},
+		{"POLL_INTERVAL", "interval between Kie task status polls", durationVar(&c.PollInterval)},
+		{"TASK_TIMEOUT", "maximum time to wait for a Kie task", durationVar(&c.TaskTimeout)},
+		{"MAX_IMAGE_INPUTS", "maximum number of uploaded images per generation", intVar(&c.MaxImageInputs)},
+		{"CAPTION_PROMPT_MAX", "maximum prompt length shown in result captions", intVar(&c.CaptionPromptMax)},
+		{"INLINE_DEFAULT_MODEL", "model used by inline mode when the user has none selected", stringVar(&c.InlineDefaultModel)},
+		{"EDIT_DEFAULT_MODEL", "image_input model used when a user replies to a result with edit instructions, empty to disable", stringVar(&c.EditDefaultModel)},
+		{"ANIMATE_MODEL", "video model opened by the Animate button on image results, empty to hide the button", stringVar(&c.AnimateModel)},
+		{"QUOTAS", "generation quotas per tier, e.g. free:image=10/day,video=2/week;pro:image=100/day", quotasVar(&c.Quotas)},
+		{"QUOTA_TIMEZONE", "time zone in which daily/weekly quotas reset", stringVar(&c.QuotaTimezone)},
+		{"CREDIT_PACKAGES", "credit packages sold for Telegram Stars as credits:stars, e.g. 50:25,150:70", creditPackagesVar(&c.CreditPackages)},
+		{"CREDIT_COSTS", "credits charged per generation once the quota is used up, e.g. image=1,video=5", creditCostsVar(&c.CreditCosts)},
+		{"REFERRAL_BONUS", "credits given to both the referrer and the invited user after the first generation", intVar(&c.ReferralBonus)},
+		{"MODERATION_BLOCKLIST", "comma-separated words or phrases that block a prompt", stringListVar(&c.ModerationBlocklist)},
+		{"MODERATION_RULES_FILE", "file with one blocked word per line, or a regex prefixed with re:", stringVar(&c.ModerationRulesFile)},
+		{"MODERATION_HOOK_URL", "URL of an external moderation service, empty to disable", stringVar(&c.ModerationHookURL)},
+		{"MODERATION_HOOK_TIMEOUT", "timeout for the moderation hook", durationVar(&c.ModerationHookTimeout)},
+		{"MODERATION_STRIKES", "blocked prompts within the strike window that lead to a ban, 0 to never ban", intVar(&c.ModerationStrikes)},
+		{"MODERATION_STRIKE_WINDOW", "period in which blocked prompts count as strikes", durationVar(&c.ModerationStrikeWindow)},
+		{"MODERATION_BAN_DURATION", "how long a user is banned from generating", durationVar(&c.ModerationBanDuration)},
+		{"ENHANCE_API_URL", "OpenAI-compatible chat completions URL used to improve prompts, empty to disable", stringVar(&c.EnhanceAPIURL)},
+		{"ENHANCE_API_KEY", "API key for the prompt enhancer, defaults to KIE_API_KEY", stringVar(&c.EnhanceAPIKey)},
+		{"ENHANCE_MODEL", "text model name sent to the prompt enhancer", stringVar(&c.EnhanceModel)},
+		{"ENHANCE_TIMEOUT", "timeout for improving one prompt", durationVar(&c.EnhanceTimeout)},
+		{"UPDATE_WORKERS", "number of chats whose updates are handled in parallel", intVar(&c.UpdateWorkers)},
+		{"UPDATE_QUEUE_SIZE", "maximum updates queued before polling pauses", intVar(&c.UpdateQueueSize)},
+		{"KIE_HTTP_TIMEOUT", "timeout for Kie API requests", durationVar(&c.KieHTTPTimeout)},
+		{"UPLOAD_TIMEOUT", "timeout for uploading results to Telegram and for downloading results and user uploads", durationVar(&c.UploadTimeout)},
+		{"SEND_AS_DOCUMENT", "always send results as documents (no Telegram compression)", boolVar(&c.SendAsDocument)},
+		{"HTTP_ADDR", "listen address of the built-in HTTP server, empty to disable", stringVar(&c.HTTPAddr)},
+		{"MEDIA_DIR", "directory for cached result files", stringVar(&c.MediaDir)},
+		{"MEDIA_PUBLIC_URL", "public base URL of the media proxy, empty to disable", stringVar(&c.MediaPublicURL)},
+		{"MEDIA_SECRET", "secret used to sign media links", stringVar(&c.MediaSecret)},
+		{"MEDIA_RETENTION", "how long cached result files are kept", durationVar(&c.MediaRetention)},
+		{"MEDIA_LINK_TTL", "how long signed media links stay valid", durationVar(&c.MediaLinkTTL)},
+		{"LOG_LEVEL", "minimum log level: debug, info, warn or error", stringVar(&c.LogLevel)},
+		{"LOG_FORMAT", "log output format: text or json", stringVar(&c.LogFormat)},
+	}
+}
+
+// LoadConfig builds the configuration from all layers and validates it.
+// args are the command-line arguments without the program name.
+func LoadConfig(args []string) (*models.Config, error) {
+	cfg, err := Load(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Load builds the configuration from all layers without validating it, for
+// tools that only need a few settings (e.g. the database path).
+func Load(args []string) (*models.Config, error) {
+	cfg := Defaults()
+	table := settings(cfg)
+
+	fs := flag.NewFlagSet("kiebot", flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to a JSON config file (or CONFIG_FILE)")
+	envPath := fs.String("env-file", ".env", "path to a .env file")
+	flagValues := make(map[string]*string)
+	for _, s := range table {
+		flagValues[s.Env] = fs.String(s.flagName(), "", s.Usage+" ("+s.Env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// 1. File config
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := applyFile(path, table); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Environment: env asli menimpa isi file .env. Nilai kosong yang diset
+	// eksplisit (misal ANIMATE_MODEL=) juga menimpa, sama seperti "" di file
+	// config; env yang tidak diset sama sekali tidak mengubah apa pun.
+	dotenv, err := readDotEnv(*envPath)
 	if err != nil {
 		return nil, err
 	}
+	for _, s := range table {
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			value, ok = dotenv[s.Env]
+		}
+		if ok {
+			if err := s.set(value); err != nil {
+				return nil, fmt.Errorf("env %s: %v", s.Env, err)
+			}
+		}
+	}
+
+	// 3. Flag command-line
+	visited := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { visited[f.Name] = true })
+	for _, s := range table {
+		if visited[s.flagName()] {
+			if err := s.set(*flagValues[s.Env]); err != nil {
+				return nil, fmt.Errorf("flag -%s: %v", s.flagName(), err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// Validate returns every configuration problem at once so operators can fix
+// them in a single pass.
+func Validate(c *models.Config) error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.TelegramToken == "" {
+		add("TELEGRAM_BOT_TOKEN is required")
+	} else if !strings.Contains(c.TelegramToken, ":") {
+		add("TELEGRAM_BOT_TOKEN does not look like a bot token")
+	}
+	if u, err := url.Parse(c.TelegramAPIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("TELEGRAM_API_URL must be an absolute http(s) URL")
+	}
+	if c.KieAPIKey == "" {
+		add("KIE_API_KEY is required")
+	}
+	switch c.DBDriver {
+	case "sqlite":
+		if c.DBPath == "" {
+			add("DB_PATH is required")
+		}
+	case "postgres":
+		if c.DatabaseURL == "" {
+			add("DATABASE_URL is required when DB_DRIVER is postgres")
+		}
+	default:
+		add("DB_DRIVER must be sqlite or postgres")
+	}
+	if c.DefaultLang == "" {
+		add("DEFAULT_LANG is required")
+	}
+	if _, err := os.Stat(c.ModelsPath); err != nil {
+		add("MODELS_PATH: %v", err)
+	}
+	if info, err := os.Stat(c.LocalesDir); err != nil || !info.IsDir() {
+		add("LOCALES_DIR %q is not a directory", c.LocalesDir)
+	}
+	for _, id := range c.AdminIDs {
+		if id <= 0 {
+			add("ADMIN_IDS contains invalid user ID %d", id)
+		}
+	}
+
+	if c.PollInterval < time.Second {
+		add("POLL_INTERVAL must be at least 1s")
+	}
+	if c.TaskTimeout <= c.PollInterval {
+		add("TASK_TIMEOUT must be longer than POLL_INTERVAL")
+	}
+	if c.MaxImageInputs < 1 {
+		add("MAX_IMAGE_INPUTS must be at least 1")
+	}
+	if c.CaptionPromptMax < 1 {
+		add("CAPTION_PROMPT_MAX must be at least 1")
+	}
+	if _, err := time.LoadLocation(c.QuotaTimezone); err != nil {
+		add("QUOTA_TIMEZONE: %v", err)
+	}
+	if c.ReferralBonus < 0 {
+		add("REFERRAL_BONUS must not be negative")
+	}
+	if c.ModerationRulesFile != "" {
+		if _, err := os.Stat(c.ModerationRulesFile); err != nil {
+			add("MODERATION_RULES_FILE: %v", err)
+		}
+	}
+	if c.ModerationHookURL != "" {
+		if u, err := url.Parse(c.ModerationHookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("MODERATION_HOOK_URL must be an absolute http(s) URL")
+		}
+	}
+	if c.ModerationHookTimeout <= 0 {
+		add("MODERATION_HOOK_TIMEOUT must be positive")
+	}
+	if c.ModerationStrikes < 0 {
+		add("MODERATION_STRIKES must not be negative")
+	}
+	if c.ModerationStrikes > 0 && (c.ModerationStrikeWindow <= 0 || c.ModerationBanDuration <= 0) {
+		add("MODERATION_STRIKE_WINDOW and MODERATION_BAN_DURATION must be positive")
+	}
+	if c.EnhanceAPIURL != "" {
+		if u, err := url.Parse(c.EnhanceAPIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("ENHANCE_API_URL must be an absolute http(s) URL")
+		}
+	}
+	if c.EnhanceTimeout <= 0 {
+		add("ENHANCE_TIMEOUT must be positive")
+	}
+	if c.UpdateWorkers < 1 {
+		add("UPDATE_WORKERS must be at least 1")
+	}
+	if c.UpdateQueueSize < c.UpdateWorkers {
+		add("UPDATE_QUEUE_SIZE must be at least UPDATE_WORKERS")
+	}
+	if c.KieHTTPTimeout <= 0 {
+		add("KIE_HTTP_TIMEOUT must be positive")
+	}
+	if c.UploadTimeout <= 0 {
+		add("UPLOAD_TIMEOUT must be positive")
+	}
+
+	if c.MediaPublicURL != "" {
+		if c.HTTPAddr == "" {
+			add("MEDIA_PUBLIC_URL requires HTTP_ADDR")
+		}
+		if u, err := url.Parse(c.MediaPublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("MEDIA_PUBLIC_URL must be an absolute http(s) URL")
+		}
+		if len(c.MediaSecret) < 16 {
+			add("MEDIA_SECRET must be at least 16 characters")
+		}
+		if c.MediaDir == "" {
+			add("MEDIA_DIR is required")
+		}
+		if c.MediaRetention <= 0 || c.MediaLinkTTL <= 0 {
+			add("MEDIA_RETENTION and MEDIA_LINK_TTL must be positive")
+		}
+	}
+
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		add("LOG_LEVEL must be one of debug, info, warn, error")
+	}
+	switch strings.ToLower(c.LogFormat) {
+	case "text", "json":
+	default:
+		add("LOG_FORMAT must be text or json")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+}
+
+func applyFile(path string, table []setting) error {
+	// Hanya JSON yang didukung; YAML/TOML akan gagal di-parse dengan pesan
+	// yang membingungkan, jadi tolak dari ekstensinya.
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".json" {
+		return fmt.Errorf("config file %s: only JSON config files (.json) are supported", path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	byKey := make(map[string]setting)
+	for _, s := range table {
+		byKey[s.fileKey()] = s
+	}
+
+	for key, val := range raw {
+		s, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown key %q", path, key)
+		}
+		if err := s.set(fileValue(val)); err != nil {
+			return fmt.Errorf("config file %s: %s: %v", path, key, err)
+		}
+	}
+	return nil
+}
+
+// fileValue mengubah nilai JSON ke bentuk string yang sama dengan env/flag.
+func fileValue(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fileValue(item))
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(val)
+}
+
+// readDotEnv membaca file .env sederhana (KEY=VALUE). File yang tidak ada diabaikan.
+func readDotEnv(path string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return values, nil
+		}
+		return nil, err
+	}
 	defer file.Close()
 
-	config := &models.Config{}
 	scanner := bufio.NewScanner(file)
-
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
 			continue
 		}
-
 		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
+		value := strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+func stringVar(target *string) func(string) error {
+	return func(v string) error {
+		*target = v
+		return nil
+	}
+}
 
-		switch key {
-		case "TELEGRAM_BOT_TOKEN":
-			config.TelegramToken = value
-		case "KIE_API_KEY":
-			config.KieAPIKey = value
-		case "DB_PATH":
-			config.DBPath = value
-		case "DEFAULT_LANG":
-			config.DefaultLang = value
+func durationVar(target *time.Duration) func(string) error {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
 		}
+		*target = d
+		return nil
 	}
+}
 
-	if config.TelegramToken == "" || config.KieAPIKey == "" {
-		log.Println("Error: Missing critical environment variables")
+func intVar(target *int) func(string) error {
+	return func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*target = n
+		return nil
 	}
+}
 
-	return config, scanner.Err()
-}
\ No newline at end of file
+func boolVar(target *bool) func(string) error {
+	return func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*target = b
+		return nil
+	}
+}
+
+// quotasVar membaca "tier:jenis=N/periode,...;tier2:..." misalnya
+// "free:image=10/day,video=2/week;pro:image=100/day,video=20/week".
+func quotasVar(target *map[string]map[string]models.QuotaLimit) func(string) error {
+	return func(v string) error {
+		quotas := make(map[string]map[string]models.QuotaLimit)
+		for _, tierSpec := range strings.Split(v, ";") {
+			tierSpec = strings.TrimSpace(tierSpec)
+			if tierSpec == "" {
+				continue
+			}
+			tier, rules, ok := strings.Cut(tierSpec, ":")
+			tier = strings.TrimSpace(tier)
+			if !ok || tier == "" {
+				return fmt.Errorf("%q: expected tier:kind=N/period", tierSpec)
+			}
+			limits := make(map[string]models.QuotaLimit)
+			for _, rule := range strings.Split(rules, ",") {
+				rule = strings.TrimSpace(rule)
+				if rule == "" {
+					continue
+				}
+				kind, spec, ok1 := strings.Cut(rule, "=")
+				count, period, ok2 := strings.Cut(spec, "/")
+				n, err := strconv.Atoi(count)
+				if !ok1 || !ok2 || err != nil || n < 0 {
+					return fmt.Errorf("%q: expected kind=N/period", rule)
+				}
+				if kind != "image" && kind != "video" {
+					return fmt.Errorf("%q: kind must be image or video", rule)
+				}
+				if period != "day" && period != "week" && period != "month" {
+					return fmt.Errorf("%q: period must be day, week or month", rule)
+				}
+				limits[kind] = models.QuotaLimit{Limit: n, Period: period}
+			}
+			quotas[tier] = limits
+		}
+		*target = quotas
+		return nil
+	}
+}
+
+// creditPackagesVar membaca "kredit:stars,..." misalnya "50:25,150:70".
+func creditPackagesVar(target *[]models.CreditPackage) func(string) error {
+	return func(v string) error {
+		var list []models.CreditPackage
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			credits, stars, ok := strings.Cut(part, ":")
+			c, err1 := strconv.Atoi(credits)
+			s, err2 := strconv.Atoi(stars)
+			if !ok || err1 != nil || err2 != nil || c < 1 || s < 1 {
+				return fmt.Errorf("%q: expected credits:stars", part)
+			}
+			list = append(list, models.CreditPackage{Credits: c, Stars: s})
+		}
+		*target = list
+		return nil
+	}
+}
+
+// creditCostsVar membaca "jenis=N,..." misalnya "image=1,video=5". Jenis yang
+// tidak disebut atau bernilai 0 tidak bisa dibayar dengan kredit.
+func creditCostsVar(target *map[string]int) func(string) error {
+	return func(v string) error {
+		costs := make(map[string]int)
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			kind, cost, ok := strings.Cut(part, "=")
+			n, err := strconv.Atoi(cost)
+			if !ok || err != nil || n < 0 {
+				return fmt.Errorf("%q: expected kind=N", part)
+			}
+			if kind != "image" && kind != "video" {
+				return fmt.Errorf("%q: kind must be image or video", part)
+			}
+			costs[kind] = n
+		}
+		*target = costs
+		return nil
+	}
+}
+
+func stringListVar(target *[]string) func(string) error {
+	return func(v string) error {
+		var list []string
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, part)
+			}
+		}
+		*target = list
+		return nil
+	}
+}
+
+func int64ListVar(target *[]int64) func(string) error {
+	return func(v string) error {
+		var list []int64
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				return err
+			}
+			list = append(list, n)
+		}
+		*target = list
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kieAITelegram/internal/models"
+)
+
+// unsetenv menghapus env selama test dan mengembalikannya setelah selesai.
+func unsetenv(t *testing.T, keys ...string) {
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+// loadWithDotEnv memanggil Load dengan file .env berisi dotenv.
+func loadWithDotEnv(t *testing.T, dotenv string, args ...string) (*models.Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte(dotenv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return Load(append([]string{"-env-file", path}, args...))
+}
+
+func TestLoadEmptyEnvOverridesDefault(t *testing.T) {
+	t.Setenv("EDIT_DEFAULT_MODEL", "")
+	t.Setenv("ANIMATE_MODEL", "")
+	unsetenv(t, "INLINE_DEFAULT_MODEL")
+
+	cfg, err := loadWithDotEnv(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.EditDefaultModel != "" || cfg.AnimateModel != "" {
+		t.Fatalf("empty env ignored: edit=%q animate=%q", cfg.EditDefaultModel, cfg.AnimateModel)
+	}
+	// Env yang tidak diset tidak menimpa default.
+	if cfg.InlineDefaultModel != Defaults().InlineDefaultModel {
+		t.Fatalf("unset env changed the default: %q", cfg.InlineDefaultModel)
+	}
+}
+
+func TestLoadEmptyDotEnvOverridesDefault(t *testing.T) {
+	unsetenv(t, "ANIMATE_MODEL", "QUOTAS", "POLL_INTERVAL")
+
+	cfg, err := loadWithDotEnv(t, "ANIMATE_MODEL=\nQUOTAS=\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AnimateModel != "" || len(cfg.Quotas) != 0 {
+		t.Fatalf("empty .env values ignored: animate=%q quotas=%v", cfg.AnimateModel, cfg.Quotas)
+	}
+	if cfg.PollInterval != 3*time.Second {
+		t.Fatalf("poll interval = %v, want the default", cfg.PollInterval)
+	}
+}
+
+func TestLoadEmptyEnvForNumberIsAnError(t *testing.T) {
+	unsetenv(t, "POLL_INTERVAL")
+
+	_, err := loadWithDotEnv(t, "POLL_INTERVAL=\n")
+	if err == nil || !strings.Contains(err.Error(), "POLL_INTERVAL") {
+		t.Fatalf("got %v, want an error naming POLL_INTERVAL", err)
+	}
+}
+
+func TestLoadFlagOverridesEnv(t *testing.T) {
+	t.Setenv("ANIMATE_MODEL", "veo-3")
+
+	cfg, err := loadWithDotEnv(t, "", "-animate-model", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AnimateModel != "" {
+		t.Fatalf("animate model = %q, want the empty flag value", cfg.AnimateModel)
+	}
+}
+
+func TestLoadRejectsNonJSONConfigFile(t *testing.T) {
+	unsetenv(t, "CONFIG_FILE")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("POLL_INTERVAL: 5s\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadWithDotEnv(t, "", "-config", path)
+	if err == nil || !strings.Contains(err.Error(), "only JSON") {
+		t.Fatalf("got %v, want an error rejecting the YAML file", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 )
 
 type AIModel struct {
@@ -15,6 +16,73 @@ type AIModel struct {
 	Ratios       []string `json:"ratios"`
 	Resolutions  []string `json:"resolutions"`
 	Formats      []string `json:"formats"`
+
+	// RequiresImage true untuk model edit yang tidak bisa jalan tanpa image_input.
+	RequiresImage bool `json:"requires_image,omitempty"`
+
+	// Batas per model. Nilai kosong/0 memakai default global dari config.
+	MaxImages        int      `json:"max_images,omitempty"`
+	PollInterval     Duration `json:"poll_interval,omitempty"`
+	Timeout          Duration `json:"timeout,omitempty"`
+	CaptionPromptMax int      `json:"caption_prompt_max,omitempty"`
+}
+
+// Limits adalah batas efektif untuk satu model setelah digabung dengan default.
+type Limits struct {
+	MaxImages        int
+	PollInterval     time.Duration
+	Timeout          time.Duration
+	CaptionPromptMax int
+}
+
+// Limits returns the model's limits, falling back to def for unset fields.
+func (m *AIModel) Limits(def Limits) Limits {
+	l := def
+	if m.MaxImages > 0 {
+		l.MaxImages = m.MaxImages
+	}
+	if m.PollInterval.Duration > 0 {
+		l.PollInterval = m.PollInterval.Duration
+	}
+	if m.Timeout.Duration > 0 {
+		l.Timeout = m.Timeout.Duration
+	}
+	if m.CaptionPromptMax > 0 {
+		l.CaptionPromptMax = m.CaptionPromptMax
+	}
+	return l
+}
+
+// Supports reports whether op is one of the model's supported_ops.
+func (m *AIModel) Supports(op string) bool {
+	for _, o := range m.SupportedOps {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Duration membaca durasi dari string JSON seperti "15m".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5m\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
 }
 
 type Provider struct {
@@ -37,10 +105,31 @@ func LoadRegistry(filePath string) error {
 		return fmt.Errorf("failed to parse models json: %v", err)
 	}
 
+	for _, p := range providers {
+		for _, m := range p.Models {
+			if m.MaxImages < 0 || m.CaptionPromptMax < 0 || m.PollInterval.Duration < 0 || m.Timeout.Duration < 0 {
+				return fmt.Errorf("model %s: limits must not be negative", m.ID)
+			}
+			if m.PollInterval.Duration > 0 && m.PollInterval.Duration < time.Second {
+				return fmt.Errorf("model %s: poll_interval must be at least 1s", m.ID)
+			}
+		}
+	}
+
 	AI_REGISTRY = providers
 	return nil
 }
 
+// Loaded reports whether a registry with at least one model has been loaded.
+func Loaded() bool {
+	for _, p := range AI_REGISTRY {
+		if len(p.Models) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func GetModelByID(id string) *AIModel {
 	for _, p := range AI_REGISTRY {
 		for _, m := range p.Models {
@@ -52,6 +141,15 @@ func GetModelByID(id string) *AIModel {
 	return nil
 }
 
+// ModelType returns the type of the model's provider, "image" or "video".
+// Providers without a type are image providers.
+func ModelType(modelID string) string {
+	if p := GetProviderForModel(modelID); p != nil && p.Type != "" {
+		return p.Type
+	}
+	return "image"
+}
+
 func GetProviderByID(id string) *Provider {
 	for _, p := range AI_REGISTRY {
 		if p.ID == id {
@@ -59,4 +157,15 @@ func GetProviderByID(id string) *Provider {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+func GetProviderForModel(modelID string) *Provider {
+	for _, p := range AI_REGISTRY {
+		for _, m := range p.Models {
+			if m.ID == modelID {
+				return &p
+			}
+		}
+	}
+	return nil
+}
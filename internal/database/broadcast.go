@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// broadcastStore berisi query broadcast yang sama untuk semua driver; bagian
+// yang berbeda diambil dari dialect.
+type broadcastStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+const broadcastColumns = `broadcast_id, admin_id, chat_id, message_id, text, CAST(buttons AS TEXT), segment_lang,
+	segment_active_days, status, last_user_id, total, sent, failed, blocked, created_at`
+
+func scanBroadcast(row rowScanner) (*Broadcast, error) {
+	var bc Broadcast
+	var buttons string
+	err := row.Scan(&bc.ID, &bc.AdminID, &bc.ChatID, &bc.MessageID, &bc.Text, &buttons, &bc.Segment.Lang,
+		&bc.Segment.ActiveDays, &bc.Status, &bc.LastUserID, &bc.Total, &bc.Sent, &bc.Failed, &bc.Blocked, &bc.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(buttons), &bc.Buttons); err != nil {
+		return nil, err
+	}
+	return &bc, nil
+}
+
+// CreateBroadcast menyimpan broadcast baru (biasanya berstatus draft) dan
+// mengembalikan ID-nya.
+func (s *broadcastStore) CreateBroadcast(bc *Broadcast) (int64, error) {
+	buttons := bc.Buttons
+	if buttons == nil {
+		buttons = []BroadcastButton{}
+	}
+	buttonsJSON, err := json.Marshal(buttons)
+	if err != nil {
+		return 0, err
+	}
+
+	query := s.dialect.rebind(`INSERT INTO broadcasts (admin_id, chat_id, message_id, text, buttons, segment_lang, segment_active_days, status, total)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING broadcast_id`)
+	var id int64
+	err = s.db.QueryRow(query, bc.AdminID, bc.ChatID, bc.MessageID, bc.Text, string(buttonsJSON),
+		bc.Segment.Lang, bc.Segment.ActiveDays, bc.Status, bc.Total).Scan(&id)
+	return id, err
+}
+
+func (s *broadcastStore) GetBroadcast(id int64) (*Broadcast, error) {
+	query := s.dialect.rebind(`SELECT ` + broadcastColumns + ` FROM broadcasts WHERE broadcast_id = ?`)
+	return scanBroadcast(s.db.QueryRow(query, id))
+}
+
+func (s *broadcastStore) ListBroadcasts(status string) ([]Broadcast, error) {
+	query := s.dialect.rebind(`SELECT ` + broadcastColumns + ` FROM broadcasts WHERE status = ? ORDER BY broadcast_id`)
+	rows, err := s.db.Query(query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Broadcast
+	for rows.Next() {
+		bc, err := scanBroadcast(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *bc)
+	}
+	return list, rows.Err()
+}
+
+func (s *broadcastStore) SetBroadcastStatus(id int64, from string, to string) (bool, error) {
+	query := s.dialect.rebind(`UPDATE broadcasts SET status = ? WHERE broadcast_id = ? AND status = ?`)
+	res, err := s.db.Exec(query, to, id, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// SaveBroadcastProgress menyimpan posisi dan hitungan pengiriman (bukan status).
+func (s *broadcastStore) SaveBroadcastProgress(bc *Broadcast) error {
+	query := s.dialect.rebind(`UPDATE broadcasts SET message_id = ?, last_user_id = ?, total = ?, sent = ?, failed = ?, blocked = ?
+			  WHERE broadcast_id = ?`)
+	_, err := s.db.Exec(query, bc.MessageID, bc.LastUserID, bc.Total, bc.Sent, bc.Failed, bc.Blocked, bc.ID)
+	return err
+}
+
+func (s *broadcastStore) segmentWhere(seg Segment) (string, []interface{}) {
+	conds := []string{"blocked_at IS NULL"}
+	var args []interface{}
+	if seg.Lang != "" {
+		if seg.IncludeUnsetLang {
+			conds = append(conds, "(language_code = ? OR language_code = '')")
+		} else {
+			conds = append(conds, "language_code = ?")
+		}
+		args = append(args, seg.Lang)
+	}
+	if seg.ActiveDays > 0 {
+		conds = append(conds, s.dialect.activeWithin)
+		args = append(args, seg.ActiveDays)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func (s *broadcastStore) CountRecipients(seg Segment) (int, error) {
+	where, args := s.segmentWhere(seg)
+	var n int
+	err := s.db.QueryRow(s.dialect.rebind(`SELECT COUNT(*) FROM users WHERE `+where), args...).Scan(&n)
+	return n, err
+}
+
+func (s *broadcastStore) ListRecipients(seg Segment, afterUserID int64, limit int) ([]int64, error) {
+	where, args := s.segmentWhere(seg)
+	args = append(args, afterUserID, limit)
+	query := s.dialect.rebind(`SELECT user_id FROM users WHERE ` + where + ` AND user_id > ? ORDER BY user_id LIMIT ?`)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ledgerStore berisi query kredit, pembayaran dan referral yang sama untuk
+// semua driver.
+type ledgerStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// applyCredits mencatat satu entri ledger dan mengubah saldo dalam tx.
+// Hasilnya false jika (reason, ref) sudah pernah dicatat. Pengurangan yang
+// membuat saldo negatif ditolak dengan ErrInsufficientCredits, kecuali
+// allowNegative (refund: Stars sudah kembali ke user, kreditnya tetap ditarik).
+func (s *ledgerStore) applyCredits(tx *sql.Tx, userID int64, amount int, reason string, ref string, allowNegative bool) (bool, error) {
+	res, err := tx.Exec(s.dialect.rebind(`INSERT INTO credit_ledger (user_id, amount, reason, ref) VALUES (?, ?, ?, ?)
+		ON CONFLICT (reason, ref) WHERE ref <> '' DO NOTHING`), userID, amount, reason, ref)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	if amount < 0 && !allowNegative {
+		res, err := tx.Exec(s.dialect.rebind(`UPDATE user_credits SET balance = balance + ?
+			WHERE user_id = ? AND balance + ? >= 0`), amount, userID, amount)
+		if err != nil {
+			return false, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		if n == 0 {
+			return false, ErrInsufficientCredits
+		}
+		return true, nil
+	}
+
+	_, err = tx.Exec(s.dialect.rebind(`INSERT INTO user_credits (user_id, balance) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET balance = user_credits.balance + excluded.balance`), userID, amount)
+	return err == nil, err
+}
+
+func (s *ledgerStore) AddCredits(userID int64, amount int, reason string, ref string) (bool, error) {
+	var applied bool
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		var err error
+		applied, err = s.applyCredits(tx, userID, amount, reason, ref, false)
+		return err
+	})
+	return applied, err
+}
+
+func (s *ledgerStore) ReverseCredits(reason string, ref string, newReason string) (bool, error) {
+	var applied bool
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		var userID int64
+		var amount int
+		err := tx.QueryRow(s.dialect.rebind(`SELECT user_id, amount FROM credit_ledger WHERE reason = ? AND ref = ?`),
+			reason, ref).Scan(&userID, &amount)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		applied, err = s.applyCredits(tx, userID, -amount, newReason, ref, true)
+		return err
+	})
+	return applied, err
+}
+
+func (s *ledgerStore) GetCreditBalance(userID int64) (int, error) {
+	var balance int
+	err := s.db.QueryRow(s.dialect.rebind(`SELECT balance FROM user_credits WHERE user_id = ?`), userID).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return balance, err
+}
+
+func (s *ledgerStore) RecordPurchase(p *Payment) (bool, error) {
+	var applied bool
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(s.dialect.rebind(`INSERT INTO payments (charge_id, user_id, credits, stars, payload, status)
+			VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (charge_id) DO NOTHING`),
+			p.ChargeID, p.UserID, p.Credits, p.Stars, p.Payload, PaymentPaid)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		applied, err = s.applyCredits(tx, p.UserID, p.Credits, CreditPurchase, p.ChargeID, false)
+		return err
+	})
+	return applied, err
+}
+
+func (s *ledgerStore) RefundPurchase(chargeID string) (bool, error) {
+	var applied bool
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		var userID int64
+		var credits int
+		err := tx.QueryRow(s.dialect.rebind(`UPDATE payments SET status = ? WHERE charge_id = ? AND status = ?
+			RETURNING user_id, credits`), PaymentRefunded, chargeID, PaymentPaid).Scan(&userID, &credits)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Tidak ada atau sudah di-refund; bedakan untuk pemanggil.
+			var one int
+			err = tx.QueryRow(s.dialect.rebind(`SELECT 1 FROM payments WHERE charge_id = ?`), chargeID).Scan(&one)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		applied, err = s.applyCredits(tx, userID, -credits, CreditRefund, chargeID, true)
+		return err
+	})
+	return applied, err
+}
+
+func (s *ledgerStore) GetPayment(chargeID string) (*Payment, error) {
+	var p Payment
+	err := s.db.QueryRow(s.dialect.rebind(`SELECT charge_id, user_id, credits, stars, payload, status, created_at
+		FROM payments WHERE charge_id = ?`), chargeID).
+		Scan(&p.ChargeID, &p.UserID, &p.Credits, &p.Stars, &p.Payload, &p.Status, &p.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
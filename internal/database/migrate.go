@@ -0,0 +1,299 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File migrasi bernama NNNN_nama.up.sql dan NNNN_nama.down.sql, satu folder
+// per driver. Nomor versi harus unik, naik, dan sama untuk kedua driver; file
+// yang sudah dirilis tidak boleh diubah lagi, perubahan skema selalu lewat
+// file migrasi baru.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// dialect berisi bagian SQL yang berbeda antar driver.
+type dialect struct {
+	dir string
+	// DDL tabel schema_migrations
+	createMigrationsTable string
+	// Query dengan satu parameter (nama tabel) yang mengembalikan jumlah tabel
+	tableExists string
+	// Query dengan satu parameter (nama tabel) yang mengembalikan nama kolom
+	tableColumns string
+	// rebind mengubah placeholder "?" ke format driver
+	rebind func(query string) string
+	// Kondisi users "aktif dalam N hari terakhir", satu parameter (N)
+	activeWithin string
+}
+
+// migrator menjalankan migrasi untuk satu koneksi database. Method-nya
+// (Migrate, MigrateDownTo, MigrationStatus) dipakai langsung oleh store.
+type migrator struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func (m *migrator) migrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, m.dialect.dir+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base := path.Base(file)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: name must end in .up.sql or .down.sql", base)
+		}
+
+		stem := strings.TrimSuffix(base, "."+direction+".sql")
+		num, name, ok := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: name must start with a positive version number", base)
+		}
+
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		mig, exists := byVersion[version]
+		if !exists {
+			mig = &Migration{Version: version, Name: name}
+			byVersion[version] = mig
+		} else if mig.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, mig.Name, name)
+		}
+		if direction == "up" {
+			mig.Up = string(content)
+		} else {
+			mig.Down = string(content)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", mig.Version, mig.Name)
+		}
+		list = append(list, *mig)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// appliedMigrations membaca versi yang sudah diterapkan tanpa membuat tabel
+// apa pun, sehingga aman dipakai pada koneksi read-only.
+func (m *migrator) appliedMigrations() (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+
+	var count int
+	if err := m.db.QueryRow(m.dialect.rebind(m.dialect.tableExists), "schema_migrations").Scan(&count); err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return applied, nil
+	}
+
+	rows, err := m.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus lists every known migration and whether it is applied. It
+// fails when the database has a migration applied that this binary does not
+// know, i.e. it was migrated by a newer version.
+func (m *migrator) MigrationStatus() ([]MigrationStatus, error) {
+	all, err := m.migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]bool)
+	list := make([]MigrationStatus, 0, len(all))
+	for _, mig := range all {
+		at, ok := applied[mig.Version]
+		known[mig.Version] = true
+		list = append(list, MigrationStatus{Migration: mig, Applied: ok, AppliedAt: at})
+	}
+	for version := range applied {
+		if !known[version] {
+			return list, fmt.Errorf("database has migration %d applied, which this binary does not know; upgrade the bot", version)
+		}
+	}
+	return list, nil
+}
+
+// Migrate applies all pending migrations in order. Each migration runs in its
+// own transaction together with its schema_migrations row, so a failing
+// migration leaves the database at the previous version.
+func (m *migrator) Migrate() error {
+	if _, err := m.db.Exec(m.dialect.createMigrationsTable); err != nil {
+		return err
+	}
+	status, err := m.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range status {
+		if mig.Applied {
+			continue
+		}
+		err := m.inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(mig.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(m.dialect.rebind(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`), mig.Version, mig.Name)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %v", mig.Version, mig.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateDownTo rolls back applied migrations, newest first, until the
+// database is at version target. Use 0 to roll back everything.
+func (m *migrator) MigrateDownTo(target int) error {
+	status, err := m.MigrationStatus()
+	if err != nil {
+		return err
+	}
+
+	for i := len(status) - 1; i >= 0; i-- {
+		mig := status[i]
+		if !mig.Applied || mig.Version <= target {
+			continue
+		}
+		if mig.Down == "" {
+			return fmt.Errorf("migration %04d_%s has no down file", mig.Version, mig.Name)
+		}
+		err := m.inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(mig.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(m.dialect.rebind(`DELETE FROM schema_migrations WHERE version = ?`), mig.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("rollback of %04d_%s failed: %v", mig.Version, mig.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkSchema memastikan semua tabel dan kolom di schemaColumns ada. Hanya
+// berarti jika semua migrasi sudah diterapkan.
+func (m *migrator) checkSchema() error {
+	status, err := m.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	for _, mig := range status {
+		if !mig.Applied {
+			return nil // migrasi tertunda dijalankan otomatis saat bot start
+		}
+	}
+
+	tables := make([]string, 0, len(schemaColumns))
+	for table := range schemaColumns {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var errs []string
+	for _, table := range tables {
+		rows, err := m.db.Query(m.dialect.rebind(m.dialect.tableColumns), table)
+		if err != nil {
+			return err
+		}
+		have := make(map[string]bool)
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			have[name] = true
+		}
+		rows.Close()
+
+		if len(have) == 0 {
+			errs = append(errs, fmt.Sprintf("table %s is missing", table))
+			continue
+		}
+		for _, col := range schemaColumns[table] {
+			if !have[col] {
+				errs = append(errs, fmt.Sprintf("column %s.%s is missing", table, col))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func (m *migrator) inTx(fn func(tx *sql.Tx) error) error {
+	return inTx(m.db, fn)
+}
+
+// inTx menjalankan fn dalam satu transaksi; jika fn gagal semuanya dibatalkan.
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// sqliteSchema mengembalikan DDL semua tabel dan index, kecuali
+// schema_migrations, urut sesuai nama.
+func sqliteSchema(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT type || ' ' || name || ': ' || COALESCE(sql, '') FROM sqlite_master
+		WHERE name NOT LIKE 'sqlite_%' AND name <> 'schema_migrations' ORDER BY type, name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var schema []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		schema = append(schema, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// Setiap file down harus membatalkan file up-nya: turun ke versi mana pun lalu
+// naik lagi menghasilkan skema yang sama persis.
+func TestMigrateRoundTrip(t *testing.T) {
+	db, err := OpenSQLiteDB(filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	must(t, db.Migrate())
+	full := sqliteSchema(t, db.DB)
+	status, err := db.MigrationStatus()
+	must(t, err)
+	latest := status[len(status)-1].Version
+
+	for target := latest - 1; target >= 0; target-- {
+		must(t, db.MigrateDownTo(target))
+		down := sqliteSchema(t, db.DB)
+		status, err := db.MigrationStatus()
+		must(t, err)
+		for _, mig := range status {
+			if mig.Applied != (mig.Version <= target) {
+				t.Fatalf("down to %d: migration %d applied = %v", target, mig.Version, mig.Applied)
+			}
+		}
+
+		must(t, db.Migrate())
+		if got := sqliteSchema(t, db.DB); !reflect.DeepEqual(got, full) {
+			t.Fatalf("schema after down to %d and up again:\n%q\nwant:\n%q", target, got, full)
+		}
+		must(t, db.MigrateDownTo(target))
+		if got := sqliteSchema(t, db.DB); !reflect.DeepEqual(got, down) {
+			t.Fatalf("second rollback to %d:\n%q\nwant:\n%q", target, got, down)
+		}
+		must(t, db.Migrate())
+	}
+
+	must(t, db.MigrateDownTo(0))
+	if got := sqliteSchema(t, db.DB); len(got) != 0 {
+		t.Fatalf("tables left after rolling back everything: %q", got)
+	}
+}
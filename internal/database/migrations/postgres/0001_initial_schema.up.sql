@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS users (
+	user_id BIGINT PRIMARY KEY,
+	language_code TEXT NOT NULL DEFAULT 'en',
+	created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS user_states (
+	user_id BIGINT PRIMARY KEY,
+	state TEXT DEFAULT 'IDLE',
+	selected_model TEXT DEFAULT '',
+	draft_options JSONB DEFAULT '{}'
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_jobs_user;
+DROP TABLE IF EXISTS jobs;
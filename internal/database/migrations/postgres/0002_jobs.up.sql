@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS jobs (
+	job_id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	chat_id BIGINT NOT NULL,
+	model_id TEXT NOT NULL,
+	prompt TEXT NOT NULL DEFAULT '',
+	task_id TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'pending',
+	result_url TEXT NOT NULL DEFAULT '',
+	media_name TEXT NOT NULL DEFAULT '',
+	document_file_id TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user ON jobs(user_id, created_at);
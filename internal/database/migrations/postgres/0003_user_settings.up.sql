@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS user_settings (
+	user_id BIGINT PRIMARY KEY,
+	send_original BOOLEAN NOT NULL DEFAULT FALSE
+);
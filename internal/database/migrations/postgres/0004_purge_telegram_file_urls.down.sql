@@ -0,0 +1 @@
+-- Data yang dihapus tidak bisa dikembalikan; rollback tidak melakukan apa-apa.
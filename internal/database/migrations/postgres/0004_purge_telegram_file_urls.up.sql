@@ -0,0 +1,3 @@
+-- Versi yang sama dengan migrasi SQLite supaya nomor versi kedua driver selaras.
+UPDATE user_states SET draft_options = draft_options - 'image_input'
+WHERE draft_options::text LIKE '%api.telegram.org/file/bot%';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_jobs_user_kind;
+ALTER TABLE jobs DROP COLUMN kind;
+ALTER TABLE users DROP COLUMN tier;
@@ -0,0 +1,10 @@
+-- Tier user untuk kuota (lihat QUOTAS di config).
+ALTER TABLE users ADD COLUMN tier TEXT NOT NULL DEFAULT 'free';
+
+-- Jenis model (image/video) dicatat per job supaya kuota tetap benar walaupun
+-- models.json berubah. Job lama: model video dikenali dari ID-nya (saat ini
+-- hanya Veo).
+ALTER TABLE jobs ADD COLUMN kind TEXT NOT NULL DEFAULT 'image';
+UPDATE jobs SET kind = 'video' WHERE model_id LIKE 'veo%';
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user_kind ON jobs(user_id, kind, created_at);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS payments;
+DROP INDEX IF EXISTS idx_credit_ledger_user;
+DROP INDEX IF EXISTS idx_credit_ledger_ref;
+DROP TABLE IF EXISTS credit_ledger;
+DROP TABLE IF EXISTS user_credits;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_referred_by;
+ALTER TABLE users DROP COLUMN referral_rewarded_at;
+ALTER TABLE users DROP COLUMN referred_by;
@@ -0,0 +1,14 @@
+-- Ban sementara karena terlalu sering mengirim prompt yang diblokir. Setelah
+-- lewat, nilainya tetap disimpan: strike sebelum waktu ini tidak dihitung lagi.
+ALTER TABLE users ADD COLUMN banned_until TIMESTAMPTZ;
+
+-- Prompt yang diblokir moderasi, untuk ditinjau admin dan menghitung strike.
+CREATE TABLE IF NOT EXISTS moderation_log (
+	log_id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	user_id BIGINT NOT NULL,
+	prompt TEXT NOT NULL,
+	source TEXT NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_moderation_log_user ON moderation_log(user_id, created_at);
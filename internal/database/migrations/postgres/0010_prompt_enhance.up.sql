@@ -0,0 +1,12 @@
+-- Perbaikan prompt otomatis, nonaktif sampai diaktifkan user di /settings.
+ALTER TABLE user_settings ADD COLUMN enhance_prompts BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Prompt yang sudah diperbaiki dan menunggu pilihan user (Pakai/Edit/Asli).
+-- Hanya satu per user: prompt baru menggantikan yang lama.
+CREATE TABLE IF NOT EXISTS pending_prompts (
+	user_id BIGINT PRIMARY KEY,
+	original TEXT NOT NULL,
+	enhanced TEXT NOT NULL,
+	message_id BIGINT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT now()
+);
@@ -0,0 +1,10 @@
+-- Pesan hasil yang dikirim bot per job, supaya balasan ke pesan itu bisa
+-- ditelusuri kembali ke job-nya. Satu job bisa punya beberapa pesan
+-- (foto terkompresi dan file asli).
+CREATE TABLE IF NOT EXISTS job_messages (
+	chat_id BIGINT NOT NULL,
+	message_id BIGINT NOT NULL,
+	job_id BIGINT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT now(),
+	PRIMARY KEY (chat_id, message_id)
+);
@@ -0,0 +1,14 @@
+-- Skema awal bot. IF NOT EXISTS supaya database lama (sebelum ada migrasi)
+-- bisa diadopsi tanpa error.
+CREATE TABLE IF NOT EXISTS users (
+	user_id INTEGER PRIMARY KEY,
+	language_code TEXT NOT NULL DEFAULT 'en',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_states (
+	user_id INTEGER PRIMARY KEY,
+	state TEXT DEFAULT 'IDLE',
+	selected_model TEXT DEFAULT '',
+	draft_options TEXT DEFAULT '{}'
+);
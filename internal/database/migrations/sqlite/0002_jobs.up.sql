@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS jobs (
+	job_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	model_id TEXT NOT NULL,
+	prompt TEXT NOT NULL DEFAULT '',
+	task_id TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'pending',
+	result_url TEXT NOT NULL DEFAULT '',
+	media_name TEXT NOT NULL DEFAULT '',
+	document_file_id TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_user ON jobs(user_id, created_at);
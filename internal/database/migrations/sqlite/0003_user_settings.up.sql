@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS user_settings (
+	user_id INTEGER PRIMARY KEY,
+	send_original INTEGER NOT NULL DEFAULT 0
+);
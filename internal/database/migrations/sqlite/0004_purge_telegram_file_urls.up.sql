@@ -0,0 +1,3 @@
+-- Hapus image_input lama yang masih berisi URL file Telegram (mengandung bot token).
+UPDATE user_states SET draft_options = json_remove(draft_options, '$.image_input')
+WHERE draft_options LIKE '%api.telegram.org/file/bot%';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS broadcasts;
+-- Baris users yang ditambahkan saat up (language_code '') sengaja dibiarkan:
+-- sejak itu user bisa saja sudah punya tier, kredit atau referral.
+ALTER TABLE users DROP COLUMN blocked_at;
+ALTER TABLE users DROP COLUMN last_seen_at;
@@ -0,0 +1,35 @@
+-- Aktivitas dan status blokir user, dipakai untuk segmen broadcast.
+ALTER TABLE users ADD COLUMN last_seen_at DATETIME;
+ALTER TABLE users ADD COLUMN blocked_at DATETIME;
+
+-- Sebelumnya baris users hanya dibuat saat memilih bahasa. Tambahkan user
+-- lain yang sudah pernah memakai bot; language_code '' berarti belum memilih.
+INSERT INTO users (user_id, language_code)
+SELECT user_id, '' FROM user_states WHERE true
+ON CONFLICT(user_id) DO NOTHING;
+INSERT INTO users (user_id, language_code)
+SELECT DISTINCT user_id, '' FROM jobs WHERE true
+ON CONFLICT(user_id) DO NOTHING;
+
+UPDATE users SET last_seen_at = COALESCE(
+	(SELECT MAX(created_at) FROM jobs WHERE jobs.user_id = users.user_id),
+	created_at
+);
+
+CREATE TABLE IF NOT EXISTS broadcasts (
+	broadcast_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	admin_id INTEGER NOT NULL,
+	chat_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL DEFAULT 0,
+	text TEXT NOT NULL,
+	buttons TEXT NOT NULL DEFAULT '[]',
+	segment_lang TEXT NOT NULL DEFAULT '',
+	segment_active_days INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'draft',
+	last_user_id INTEGER NOT NULL DEFAULT 0,
+	total INTEGER NOT NULL DEFAULT 0,
+	sent INTEGER NOT NULL DEFAULT 0,
+	failed INTEGER NOT NULL DEFAULT 0,
+	blocked INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,31 @@
+-- Saldo kredit per user. Selalu diubah bersama baris credit_ledger di
+-- transaksi yang sama, jadi saldo = jumlah amount di ledger.
+CREATE TABLE IF NOT EXISTS user_credits (
+	user_id INTEGER PRIMARY KEY,
+	balance INTEGER NOT NULL DEFAULT 0
+);
+
+-- Riwayat semua perubahan kredit. ref mengikat entri ke sumbernya (charge ID
+-- pembayaran, job ID); pasangan (reason, ref) unik supaya update yang
+-- dikirim ulang tidak menambah kredit dua kali.
+CREATE TABLE IF NOT EXISTS credit_ledger (
+	entry_id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	amount INTEGER NOT NULL,
+	reason TEXT NOT NULL,
+	ref TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_credit_ledger_ref ON credit_ledger(reason, ref) WHERE ref <> '';
+CREATE INDEX IF NOT EXISTS idx_credit_ledger_user ON credit_ledger(user_id, created_at);
+
+-- Pembayaran Telegram Stars, disimpan untuk refund.
+CREATE TABLE IF NOT EXISTS payments (
+	charge_id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	credits INTEGER NOT NULL,
+	stars INTEGER NOT NULL,
+	payload TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'paid',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,6 @@
+-- Referral: siapa yang mengundang user ini, dan kapan bonusnya diberikan
+-- (setelah generate pertama user yang diundang).
+ALTER TABLE users ADD COLUMN referred_by INTEGER;
+ALTER TABLE users ADD COLUMN referral_rewarded_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_users_referred_by ON users(referred_by);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_moderation_log_user;
+DROP TABLE IF EXISTS moderation_log;
+ALTER TABLE users DROP COLUMN banned_until;
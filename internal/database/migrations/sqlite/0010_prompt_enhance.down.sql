@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS pending_prompts;
+ALTER TABLE user_settings DROP COLUMN enhance_prompts;
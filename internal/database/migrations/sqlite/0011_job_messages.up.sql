@@ -0,0 +1,10 @@
+-- Pesan hasil yang dikirim bot per job, supaya balasan ke pesan itu bisa
+-- ditelusuri kembali ke job-nya. Satu job bisa punya beberapa pesan
+-- (foto terkompresi dan file asli).
+CREATE TABLE IF NOT EXISTS job_messages (
+	chat_id INTEGER NOT NULL,
+	message_id INTEGER NOT NULL,
+	job_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (chat_id, message_id)
+);
@@ -0,0 +1,356 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+var postgresDialect = dialect{
+	dir: "migrations/postgres",
+	createMigrationsTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ DEFAULT now()
+	);`,
+	tableExists:  `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`,
+	tableColumns: `SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?`,
+	rebind:       rebindDollar,
+	activeWithin: `last_seen_at >= now() - make_interval(days => ?::int)`,
+}
+
+// rebindDollar mengganti placeholder "?" menjadi $1, $2, ... untuk PostgreSQL.
+func rebindDollar(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// PostgresDB is the PostgreSQL implementation of Store, for deployments that
+// run several bot instances or already operate a Postgres server.
+type PostgresDB struct {
+	*migrator
+	*broadcastStore
+	*ledgerStore
+	DB *sql.DB
+}
+
+// NewPostgresDB connects to url and applies all pending migrations.
+func NewPostgresDB(url string) (*PostgresDB, error) {
+	instance, err := OpenPostgresDB(url)
+	if err != nil {
+		return nil, err
+	}
+	if err := instance.Migrate(); err != nil {
+		instance.Close()
+		return nil, err
+	}
+	return instance, nil
+}
+
+// OpenPostgresDB connects to url without touching the schema.
+func OpenPostgresDB(url string) (*PostgresDB, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &PostgresDB{
+		DB:             db,
+		migrator:       &migrator{db: db, dialect: postgresDialect},
+		broadcastStore: &broadcastStore{db: db, dialect: postgresDialect},
+		ledgerStore:    &ledgerStore{db: db, dialect: postgresDialect},
+	}, nil
+}
+
+func (p *PostgresDB) Ping(ctx context.Context) error {
+	return p.DB.PingContext(ctx)
+}
+
+func (p *PostgresDB) SetUserLanguage(userID int64, langCode string) error {
+	query := `INSERT INTO users (user_id, language_code) VALUES ($1, $2)
+			  ON CONFLICT (user_id) DO UPDATE SET language_code = EXCLUDED.language_code`
+	_, err := p.DB.Exec(query, userID, langCode)
+	return err
+}
+
+func (p *PostgresDB) GetUserLanguage(userID int64) (string, error) {
+	var langCode string
+	err := p.DB.QueryRow(`SELECT language_code FROM users WHERE user_id = $1 AND language_code <> ''`, userID).Scan(&langCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return langCode, nil
+}
+
+func (p *PostgresDB) TouchUser(userID int64) error {
+	query := `INSERT INTO users (user_id, language_code, last_seen_at) VALUES ($1, '', now())
+			  ON CONFLICT (user_id) DO UPDATE SET last_seen_at = now(), blocked_at = NULL`
+	_, err := p.DB.Exec(query, userID)
+	return err
+}
+
+func (p *PostgresDB) SetUserBlocked(userID int64) error {
+	_, err := p.DB.Exec(`UPDATE users SET blocked_at = now() WHERE user_id = $1`, userID)
+	return err
+}
+
+func (p *PostgresDB) GetUserTier(userID int64) (string, error) {
+	var tier string
+	err := p.DB.QueryRow(`SELECT tier FROM users WHERE user_id = $1`, userID).Scan(&tier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return tier, err
+}
+
+func (p *PostgresDB) SetUserTier(userID int64, tier string) error {
+	query := `INSERT INTO users (user_id, language_code, tier) VALUES ($1, '', $2)
+			  ON CONFLICT (user_id) DO UPDATE SET tier = EXCLUDED.tier`
+	_, err := p.DB.Exec(query, userID, tier)
+	return err
+}
+
+func (p *PostgresDB) SetUserState(userID int64, state string, modelID string) error {
+	query := `INSERT INTO user_states (user_id, state, selected_model) VALUES ($1, $2, $3)
+			  ON CONFLICT (user_id) DO UPDATE SET state = EXCLUDED.state, selected_model = EXCLUDED.selected_model`
+	_, err := p.DB.Exec(query, userID, state, modelID)
+	return err
+}
+
+// UpdateDraftOption mengubah satu key di draft langsung di SQL (jsonb_set),
+// jadi tidak perlu read-modify-write di aplikasi.
+func (p *PostgresDB) UpdateDraftOption(userID int64, key string, value interface{}) error {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE user_states
+			  SET draft_options = jsonb_set(COALESCE(draft_options, '{}'::jsonb), ARRAY[$1::text], $2::jsonb)
+			  WHERE user_id = $3`
+	_, err = p.DB.Exec(query, key, string(jsonValue), userID)
+	return err
+}
+
+// UpdateUserState mengunci baris user dengan SELECT ... FOR UPDATE, jadi
+// update bersamaan dari instance bot lain pun menunggu giliran.
+func (p *PostgresDB) UpdateUserState(userID int64, fn func(state *UserState) error) error {
+	return p.migrator.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`INSERT INTO user_states (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING`, userID); err != nil {
+			return err
+		}
+
+		var state, model, optionsRaw string
+		query := `SELECT COALESCE(state, 'IDLE'), COALESCE(selected_model, ''), COALESCE(draft_options::text, '{}')
+				  FROM user_states WHERE user_id = $1 FOR UPDATE`
+		if err := tx.QueryRow(query, userID).Scan(&state, &model, &optionsRaw); err != nil {
+			return err
+		}
+		current, err := decodeUserState(state, model, optionsRaw)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(&current); err != nil {
+			return err
+		}
+
+		draft, err := json.Marshal(current.DraftOptions)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE user_states SET state = $1, selected_model = $2, draft_options = $3::jsonb WHERE user_id = $4`,
+			current.State, current.SelectedModel, string(draft), userID)
+		return err
+	})
+}
+
+func (p *PostgresDB) GetUserState(userID int64) (UserState, error) {
+	query := `SELECT COALESCE(state, 'IDLE'), COALESCE(selected_model, ''), COALESCE(draft_options::text, '{}')
+			  FROM user_states WHERE user_id = $1`
+	var state, model, optionsRaw string
+	err := p.DB.QueryRow(query, userID).Scan(&state, &model, &optionsRaw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserState{State: "IDLE", DraftOptions: make(map[string]interface{})}, nil
+	}
+	if err != nil {
+		return UserState{}, err
+	}
+	return decodeUserState(state, model, optionsRaw)
+}
+
+func (p *PostgresDB) CreateJob(userID int64, chatID int64, modelID string, kind string, prompt string) (int64, error) {
+	query := `INSERT INTO jobs (user_id, chat_id, model_id, kind, prompt) VALUES ($1, $2, $3, $4, $5) RETURNING job_id`
+	var jobID int64
+	err := p.DB.QueryRow(query, userID, chatID, modelID, kind, prompt).Scan(&jobID)
+	return jobID, err
+}
+
+func (p *PostgresDB) SetJobTask(jobID int64, taskID string) error {
+	_, err := p.DB.Exec(`UPDATE jobs SET task_id = $1, status = 'running' WHERE job_id = $2`, taskID, jobID)
+	return err
+}
+
+func (p *PostgresDB) FinishJob(jobID int64, status string, resultURL string, mediaName string) error {
+	query := `UPDATE jobs SET status = $1, result_url = $2, media_name = $3 WHERE job_id = $4`
+	_, err := p.DB.Exec(query, status, resultURL, mediaName, jobID)
+	return err
+}
+
+func (p *PostgresDB) SetJobDocument(jobID int64, fileID string) error {
+	_, err := p.DB.Exec(`UPDATE jobs SET document_file_id = $1 WHERE job_id = $2`, fileID, jobID)
+	return err
+}
+
+func (p *PostgresDB) AddJobMessage(jobID int64, chatID int64, messageID int64) error {
+	_, err := p.DB.Exec(`INSERT INTO job_messages (chat_id, message_id, job_id) VALUES ($1, $2, $3)
+			  ON CONFLICT (chat_id, message_id) DO NOTHING`, chatID, messageID, jobID)
+	return err
+}
+
+func (p *PostgresDB) GetJobByMessage(chatID int64, messageID int64) (*Job, error) {
+	return scanJob(p.DB.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE job_id =
+			  (SELECT job_id FROM job_messages WHERE chat_id = $1 AND message_id = $2)`, chatID, messageID))
+}
+
+func (p *PostgresDB) GetJob(jobID int64) (*Job, error) {
+	return scanJob(p.DB.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE job_id = $1`, jobID))
+}
+
+func (p *PostgresDB) ListJobs(userID int64, limit int, before int64) ([]Job, error) {
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	rows, err := p.DB.Query(`SELECT `+jobColumns+` FROM jobs WHERE user_id = $1 AND job_id < $2
+			  ORDER BY job_id DESC LIMIT $3`, userID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectJobs(rows)
+}
+
+func (p *PostgresDB) CountJobsSince(userID int64, kind string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM jobs WHERE user_id = $1 AND kind = $2 AND created_at >= $3 AND status NOT IN ('failed', 'timeout', 'canceled')`
+	var n int
+	err := p.DB.QueryRow(query, userID, kind, since).Scan(&n)
+	return n, err
+}
+
+func (p *PostgresDB) AddModerationLog(e *ModerationEntry) error {
+	query := `INSERT INTO moderation_log (user_id, prompt, source, reason) VALUES ($1, $2, $3, $4)`
+	_, err := p.DB.Exec(query, e.UserID, e.Prompt, e.Source, e.Reason)
+	return err
+}
+
+func (p *PostgresDB) CountModerationSince(userID int64, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM moderation_log WHERE user_id = $1 AND created_at >= $2`
+	var n int
+	err := p.DB.QueryRow(query, userID, since).Scan(&n)
+	return n, err
+}
+
+func (p *PostgresDB) ListModerationLog(userID int64, limit int) ([]ModerationEntry, error) {
+	query := `SELECT log_id, user_id, prompt, source, reason, created_at FROM moderation_log
+			  WHERE $1::bigint = 0 OR user_id = $1 ORDER BY log_id DESC LIMIT $2`
+	rows, err := p.DB.Query(query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectModerationLog(rows)
+}
+
+func (p *PostgresDB) GetUserBan(userID int64) (time.Time, error) {
+	var until sql.NullTime
+	err := p.DB.QueryRow(`SELECT banned_until FROM users WHERE user_id = $1`, userID).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return until.Time, err
+}
+
+func (p *PostgresDB) SetUserBan(userID int64, until time.Time) error {
+	query := `INSERT INTO users (user_id, language_code, banned_until) VALUES ($1, '', $2)
+			  ON CONFLICT (user_id) DO UPDATE SET banned_until = EXCLUDED.banned_until`
+	_, err := p.DB.Exec(query, userID, until)
+	return err
+}
+
+func (p *PostgresDB) GetSendOriginal(userID int64) (bool, error) {
+	var enabled bool
+	err := p.DB.QueryRow(`SELECT send_original FROM user_settings WHERE user_id = $1`, userID).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return enabled, err
+}
+
+func (p *PostgresDB) SetSendOriginal(userID int64, enabled bool) error {
+	query := `INSERT INTO user_settings (user_id, send_original) VALUES ($1, $2)
+			  ON CONFLICT (user_id) DO UPDATE SET send_original = EXCLUDED.send_original`
+	_, err := p.DB.Exec(query, userID, enabled)
+	return err
+}
+
+func (p *PostgresDB) GetEnhancePrompts(userID int64) (bool, error) {
+	var enabled bool
+	err := p.DB.QueryRow(`SELECT enhance_prompts FROM user_settings WHERE user_id = $1`, userID).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return enabled, err
+}
+
+func (p *PostgresDB) SetEnhancePrompts(userID int64, enabled bool) error {
+	query := `INSERT INTO user_settings (user_id, enhance_prompts) VALUES ($1, $2)
+			  ON CONFLICT (user_id) DO UPDATE SET enhance_prompts = EXCLUDED.enhance_prompts`
+	_, err := p.DB.Exec(query, userID, enabled)
+	return err
+}
+
+func (p *PostgresDB) SavePendingPrompt(pp *PendingPrompt) error {
+	query := `INSERT INTO pending_prompts (user_id, original, enhanced, message_id) VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (user_id) DO UPDATE SET original = EXCLUDED.original, enhanced = EXCLUDED.enhanced,
+			  message_id = EXCLUDED.message_id, created_at = now()`
+	_, err := p.DB.Exec(query, pp.UserID, pp.Original, pp.Enhanced, pp.MessageID)
+	return err
+}
+
+func (p *PostgresDB) TakePendingPrompt(userID int64, messageID int64) (*PendingPrompt, error) {
+	query := `DELETE FROM pending_prompts WHERE user_id = $1 AND message_id = $2 RETURNING original, enhanced`
+	pp := PendingPrompt{UserID: userID, MessageID: messageID}
+	err := p.DB.QueryRow(query, userID, messageID).Scan(&pp.Original, &pp.Enhanced)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pp, nil
+}
+
+func (p *PostgresDB) Close() error {
+	return p.DB.Close()
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+)
+
+// Batas penelusuran rantai referral saat mencari loop.
+const maxReferralDepth = 100
+
+// SetReferrer mencatat referrerID sebagai pengundang userID. Ditolak (false)
+// jika user mengundang dirinya sendiri, sudah punya pengundang, sudah pernah
+// generate, pengundang tidak dikenal, atau referrerID sendiri (langsung atau
+// lewat rantai) diundang oleh userID.
+func (s *ledgerStore) SetReferrer(userID int64, referrerID int64) (bool, error) {
+	if userID == referrerID {
+		return false, nil
+	}
+	var applied bool
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		var one int
+		err := tx.QueryRow(s.dialect.rebind(`SELECT 1 FROM jobs WHERE user_id = ? LIMIT 1`), userID).Scan(&one)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		cur := referrerID
+		for i := 0; i < maxReferralDepth; i++ {
+			var next sql.NullInt64
+			err := tx.QueryRow(s.dialect.rebind(`SELECT referred_by FROM users WHERE user_id = ?`), cur).Scan(&next)
+			if errors.Is(err, sql.ErrNoRows) {
+				if cur == referrerID {
+					return nil
+				}
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if !next.Valid {
+				break
+			}
+			if next.Int64 == userID {
+				return nil
+			}
+			cur = next.Int64
+		}
+
+		_, err = tx.Exec(s.dialect.rebind(`INSERT INTO users (user_id, language_code) VALUES (?, '')
+			ON CONFLICT (user_id) DO NOTHING`), userID)
+		if err != nil {
+			return err
+		}
+		res, err := tx.Exec(s.dialect.rebind(`UPDATE users SET referred_by = ? WHERE user_id = ? AND referred_by IS NULL`),
+			referrerID, userID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		applied = n > 0
+		return err
+	})
+	return applied, err
+}
+
+// RewardReferral memberi bonus ke user dan pengundangnya, sekali saja per
+// user. Hasilnya 0 jika user tidak diundang atau bonus sudah diberikan.
+func (s *ledgerStore) RewardReferral(userID int64, bonus int) (int64, error) {
+	var referrerID int64
+	err := inTx(s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(s.dialect.rebind(`UPDATE users SET referral_rewarded_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND referred_by IS NOT NULL AND referral_rewarded_at IS NULL
+			RETURNING referred_by`), userID).Scan(&referrerID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil || bonus <= 0 {
+			return err
+		}
+		ref := strconv.FormatInt(userID, 10)
+		if _, err := s.applyCredits(tx, referrerID, bonus, CreditReferral, ref, false); err != nil {
+			return err
+		}
+		_, err = s.applyCredits(tx, userID, bonus, CreditReferralWelcome, ref, false)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return referrerID, nil
+}
+
+func (s *ledgerStore) GetReferralStats(userID int64) (ReferralStats, error) {
+	var st ReferralStats
+	err := s.db.QueryRow(s.dialect.rebind(`SELECT COUNT(*), COUNT(referral_rewarded_at) FROM users WHERE referred_by = ?`),
+		userID).Scan(&st.Invited, &st.Rewarded)
+	if err != nil {
+		return st, err
+	}
+	err = s.db.QueryRow(s.dialect.rebind(`SELECT COALESCE(SUM(amount), 0) FROM credit_ledger WHERE user_id = ? AND reason = ?`),
+		userID, CreditReferral).Scan(&st.Credits)
+	return st, err
+}
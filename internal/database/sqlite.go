@@ -1,63 +1,96 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"math"
+	"strings"
 	"sync"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-type SQLiteDB struct {
-	DB *sql.DB
-	mu sync.Mutex
+var sqliteDialect = dialect{
+	dir: "migrations/sqlite",
+	createMigrationsTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+	tableExists:  `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`,
+	tableColumns: `SELECT name FROM pragma_table_info(?)`,
+	rebind:       func(query string) string { return query },
+	activeWithin: `last_seen_at >= datetime('now', '-' || ? || ' days')`,
 }
 
-type UserState struct {
-	State        string
-	SelectedModel string
-	DraftOptions  map[string]interface{}
+// Jumlah lock per user (di-hash dari user ID). Cukup untuk menghindari
+// antrean antar user tanpa menyimpan satu mutex per user selamanya.
+const userLockStripes = 64
+
+type SQLiteDB struct {
+	*migrator
+	*broadcastStore
+	*ledgerStore
+	DB        *sql.DB
+	userLocks [userLockStripes]sync.Mutex
 }
 
+// NewSQLiteDB opens the database and applies all pending migrations.
 func NewSQLiteDB(dbPath string) (*SQLiteDB, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	instance, err := OpenSQLiteDB(dbPath)
 	if err != nil {
 		return nil, err
 	}
+	if err := instance.Migrate(); err != nil {
+		instance.Close()
+		return nil, err
+	}
+	return instance, nil
+}
 
-	if err := db.Ping(); err != nil {
+// OpenSQLiteDB opens the database without touching the schema. It is used by
+// the migrate command, which decides itself which migrations to run.
+func OpenSQLiteDB(dbPath string) (*SQLiteDB, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(dbPath))
+	if err != nil {
 		return nil, err
 	}
 
-	instance := &SQLiteDB{DB: db}
-	if err := instance.initTables(); err != nil {
+	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return instance, nil
+	return &SQLiteDB{
+		DB:             db,
+		migrator:       &migrator{db: db, dialect: sqliteDialect},
+		broadcastStore: &broadcastStore{db: db, dialect: sqliteDialect},
+		ledgerStore:    &ledgerStore{db: db, dialect: sqliteDialect},
+	}, nil
 }
 
-func (s *SQLiteDB) initTables() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-			user_id INTEGER PRIMARY KEY,
-			language_code TEXT NOT NULL DEFAULT 'en',
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`,
-		`CREATE TABLE IF NOT EXISTS user_states (
-			user_id INTEGER PRIMARY KEY,
-			state TEXT DEFAULT 'IDLE',
-			selected_model TEXT DEFAULT '',
-			draft_options TEXT DEFAULT '{}'
-		);`,
+// sqliteDSN menambahkan busy_timeout (tunggu, bukan langsung "database is
+// locked") dan transaksi IMMEDIATE (lock tulis diambil di awal transaksi, jadi
+// read-lalu-write di dalam transaksi tidak gagal saat upgrade lock).
+func sqliteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
 	}
+	return path + sep + "_pragma=busy_timeout(5000)&_txlock=immediate"
+}
 
-	for _, q := range queries {
-		if _, err := s.DB.Exec(q); err != nil {
-			return err
-		}
-	}
-	return nil
+func (s *SQLiteDB) userLock(userID int64) *sync.Mutex {
+	return &s.userLocks[uint64(userID)%userLockStripes]
+}
+
+// Ping checks that the database answers queries.
+func (s *SQLiteDB) Ping(ctx context.Context) error {
+	var one int
+	return s.DB.QueryRowContext(ctx, "SELECT 1").Scan(&one)
 }
 
 func (s *SQLiteDB) SetUserLanguage(userID int64, langCode string) error {
@@ -67,61 +100,360 @@ func (s *SQLiteDB) SetUserLanguage(userID int64, langCode string) error {
 	return err
 }
 
-func (s *SQLiteDB) GetUserLanguage(userID int64) string {
-	query := `SELECT language_code FROM users WHERE user_id = ?`
+func (s *SQLiteDB) GetUserLanguage(userID int64) (string, error) {
+	query := `SELECT language_code FROM users WHERE user_id = ? AND language_code <> ''`
 	var langCode string
 	err := s.DB.QueryRow(query, userID).Scan(&langCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
 	if err != nil {
-		return "en" 
+		return "", err
+	}
+	return langCode, nil
+}
+
+func (s *SQLiteDB) TouchUser(userID int64) error {
+	query := `INSERT INTO users (user_id, language_code, last_seen_at) VALUES (?, '', CURRENT_TIMESTAMP)
+			  ON CONFLICT(user_id) DO UPDATE SET last_seen_at = CURRENT_TIMESTAMP, blocked_at = NULL;`
+	_, err := s.DB.Exec(query, userID)
+	return err
+}
+
+func (s *SQLiteDB) SetUserBlocked(userID int64) error {
+	_, err := s.DB.Exec(`UPDATE users SET blocked_at = CURRENT_TIMESTAMP WHERE user_id = ?`, userID)
+	return err
+}
+
+func (s *SQLiteDB) GetUserTier(userID int64) (string, error) {
+	var tier string
+	err := s.DB.QueryRow(`SELECT tier FROM users WHERE user_id = ?`, userID).Scan(&tier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
 	}
-	return langCode
+	return tier, err
+}
+
+func (s *SQLiteDB) SetUserTier(userID int64, tier string) error {
+	query := `INSERT INTO users (user_id, language_code, tier) VALUES (?, '', ?)
+			  ON CONFLICT(user_id) DO UPDATE SET tier = excluded.tier;`
+	_, err := s.DB.Exec(query, userID, tier)
+	return err
 }
 
 func (s *SQLiteDB) SetUserState(userID int64, state string, modelID string) error {
+	lock := s.userLock(userID)
+	lock.Lock()
+	defer lock.Unlock()
+
 	query := `INSERT INTO user_states (user_id, state, selected_model) VALUES (?, ?, ?)
 			  ON CONFLICT(user_id) DO UPDATE SET state = excluded.state, selected_model = excluded.selected_model;`
 	_, err := s.DB.Exec(query, userID, state, modelID)
 	return err
 }
 
+// UpdateDraftOption mengubah satu key langsung di SQL (json_set), key lain tidak disentuh.
 func (s *SQLiteDB) UpdateDraftOption(userID int64, key string, value interface{}) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	currentState := s.GetUserState(userID)
-	if currentState.DraftOptions == nil {
-		currentState.DraftOptions = make(map[string]interface{})
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return err
 	}
-	currentState.DraftOptions[key] = value
 
-	jsonBytes, _ := json.Marshal(currentState.DraftOptions)
-	query := `UPDATE user_states SET draft_options = ? WHERE user_id = ?`
-	_, err := s.DB.Exec(query, string(jsonBytes), userID)
+	lock := s.userLock(userID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	query := `UPDATE user_states SET draft_options = json_set(COALESCE(draft_options, '{}'), ?, json(?)) WHERE user_id = ?`
+	_, err = s.DB.Exec(query, jsonPathKey(key), string(jsonValue), userID)
 	return err
 }
 
-func (s *SQLiteDB) GetUserState(userID int64) UserState {
+// jsonPathKey membuat path JSON SQLite untuk satu key, misal $."ratio".
+func jsonPathKey(key string) string {
+	return `$."` + strings.ReplaceAll(key, `"`, `\"`) + `"`
+}
+
+func (s *SQLiteDB) UpdateUserState(userID int64, fn func(state *UserState) error) error {
+	lock := s.userLock(userID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	return s.migrator.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`INSERT INTO user_states (user_id) VALUES (?) ON CONFLICT(user_id) DO NOTHING`, userID); err != nil {
+			return err
+		}
+
+		var state, model, optionsRaw string
+		query := `SELECT COALESCE(state, 'IDLE'), COALESCE(selected_model, ''), COALESCE(draft_options, '{}')
+				  FROM user_states WHERE user_id = ?`
+		if err := tx.QueryRow(query, userID).Scan(&state, &model, &optionsRaw); err != nil {
+			return err
+		}
+		current, err := decodeUserState(state, model, optionsRaw)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(&current); err != nil {
+			return err
+		}
+
+		draft, err := json.Marshal(current.DraftOptions)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE user_states SET state = ?, selected_model = ?, draft_options = ? WHERE user_id = ?`,
+			current.State, current.SelectedModel, string(draft), userID)
+		return err
+	})
+}
+
+func (s *SQLiteDB) GetUserState(userID int64) (UserState, error) {
 	query := `SELECT state, selected_model, draft_options FROM user_states WHERE user_id = ?`
 	var state, model, optionsRaw string
 	err := s.DB.QueryRow(query, userID).Scan(&state, &model, &optionsRaw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserState{State: "IDLE", DraftOptions: make(map[string]interface{})}, nil
+	}
 	if err != nil {
-		return UserState{State: "IDLE", DraftOptions: make(map[string]interface{})}
+		return UserState{}, err
 	}
+	return decodeUserState(state, model, optionsRaw)
+}
 
-	var options map[string]interface{}
-	json.Unmarshal([]byte(optionsRaw), &options)
-	if options == nil {
-		options = make(map[string]interface{})
+// decodeUserState mem-parse draft_options; dipakai oleh semua driver.
+func decodeUserState(state, model, optionsRaw string) (UserState, error) {
+	options := make(map[string]interface{})
+	if optionsRaw != "" {
+		if err := json.Unmarshal([]byte(optionsRaw), &options); err != nil {
+			return UserState{}, err
+		}
+		if options == nil {
+			options = make(map[string]interface{})
+		}
 	}
 
 	return UserState{
-		State:        state,
+		State:         state,
 		SelectedModel: model,
 		DraftOptions:  options,
+	}, nil
+}
+
+// CreateJob mencatat generate baru di history dan mengembalikan job ID-nya.
+func (s *SQLiteDB) CreateJob(userID int64, chatID int64, modelID string, kind string, prompt string) (int64, error) {
+	query := `INSERT INTO jobs (user_id, chat_id, model_id, kind, prompt) VALUES (?, ?, ?, ?, ?)`
+	res, err := s.DB.Exec(query, userID, chatID, modelID, kind, prompt)
+	if err != nil {
+		return 0, err
 	}
+	return res.LastInsertId()
+}
+
+func (s *SQLiteDB) SetJobTask(jobID int64, taskID string) error {
+	query := `UPDATE jobs SET task_id = ?, status = 'running' WHERE job_id = ?`
+	_, err := s.DB.Exec(query, taskID, jobID)
+	return err
+}
+
+func (s *SQLiteDB) FinishJob(jobID int64, status string, resultURL string, mediaName string) error {
+	query := `UPDATE jobs SET status = ?, result_url = ?, media_name = ? WHERE job_id = ?`
+	_, err := s.DB.Exec(query, status, resultURL, mediaName, jobID)
+	return err
+}
+
+// SetJobDocument menyimpan file_id dokumen asli agar bisa dikirim ulang tanpa upload.
+func (s *SQLiteDB) SetJobDocument(jobID int64, fileID string) error {
+	query := `UPDATE jobs SET document_file_id = ? WHERE job_id = ?`
+	_, err := s.DB.Exec(query, fileID, jobID)
+	return err
 }
 
-func (s *SQLiteDB) Close() {
+const jobColumns = `job_id, user_id, chat_id, model_id, kind, prompt, task_id, status, result_url, media_name, document_file_id, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	var j Job
+	err := row.Scan(&j.ID, &j.UserID, &j.ChatID, &j.ModelID, &j.Kind, &j.Prompt,
+		&j.TaskID, &j.Status, &j.ResultURL, &j.MediaName, &j.DocumentFileID, &j.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+func (s *SQLiteDB) AddJobMessage(jobID int64, chatID int64, messageID int64) error {
+	query := `INSERT INTO job_messages (chat_id, message_id, job_id) VALUES (?, ?, ?)
+			  ON CONFLICT(chat_id, message_id) DO NOTHING;`
+	_, err := s.DB.Exec(query, chatID, messageID, jobID)
+	return err
+}
+
+func (s *SQLiteDB) GetJobByMessage(chatID int64, messageID int64) (*Job, error) {
+	return scanJob(s.DB.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE job_id =
+			  (SELECT job_id FROM job_messages WHERE chat_id = ? AND message_id = ?)`, chatID, messageID))
+}
+
+func (s *SQLiteDB) GetJob(jobID int64) (*Job, error) {
+	return scanJob(s.DB.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE job_id = ?`, jobID))
+}
+
+func (s *SQLiteDB) ListJobs(userID int64, limit int, before int64) ([]Job, error) {
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	rows, err := s.DB.Query(`SELECT `+jobColumns+` FROM jobs WHERE user_id = ? AND job_id < ?
+			  ORDER BY job_id DESC LIMIT ?`, userID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectJobs(rows)
+}
+
+// sqliteTime memformat waktu seperti CURRENT_TIMESTAMP (UTC) agar bisa
+// dibandingkan langsung dengan kolom DATETIME.
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+func (s *SQLiteDB) CountJobsSince(userID int64, kind string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM jobs WHERE user_id = ? AND kind = ? AND created_at >= ? AND status NOT IN ('failed', 'timeout', 'canceled')`
+	var n int
+	err := s.DB.QueryRow(query, userID, kind, sqliteTime(since)).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteDB) AddModerationLog(e *ModerationEntry) error {
+	query := `INSERT INTO moderation_log (user_id, prompt, source, reason) VALUES (?, ?, ?, ?)`
+	_, err := s.DB.Exec(query, e.UserID, e.Prompt, e.Source, e.Reason)
+	return err
+}
+
+func (s *SQLiteDB) CountModerationSince(userID int64, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM moderation_log WHERE user_id = ? AND created_at >= ?`
+	var n int
+	err := s.DB.QueryRow(query, userID, sqliteTime(since)).Scan(&n)
+	return n, err
+}
+
+func (s *SQLiteDB) ListModerationLog(userID int64, limit int) ([]ModerationEntry, error) {
+	query := `SELECT log_id, user_id, prompt, source, reason, created_at FROM moderation_log
+			  WHERE ? = 0 OR user_id = ? ORDER BY log_id DESC LIMIT ?`
+	rows, err := s.DB.Query(query, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectModerationLog(rows)
+}
+
+func (s *SQLiteDB) GetUserBan(userID int64) (time.Time, error) {
+	var until sql.NullTime
+	err := s.DB.QueryRow(`SELECT banned_until FROM users WHERE user_id = ?`, userID).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return until.Time, err
+}
+
+func (s *SQLiteDB) SetUserBan(userID int64, until time.Time) error {
+	query := `INSERT INTO users (user_id, language_code, banned_until) VALUES (?, '', ?)
+			  ON CONFLICT(user_id) DO UPDATE SET banned_until = excluded.banned_until`
+	_, err := s.DB.Exec(query, userID, sqliteTime(until))
+	return err
+}
+
+func collectModerationLog(rows *sql.Rows) ([]ModerationEntry, error) {
+	defer rows.Close()
+
+	var list []ModerationEntry
+	for rows.Next() {
+		var e ModerationEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Prompt, &e.Source, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+func collectJobs(rows *sql.Rows) ([]Job, error) {
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *SQLiteDB) GetSendOriginal(userID int64) (bool, error) {
+	query := `SELECT send_original FROM user_settings WHERE user_id = ?`
+	var enabled bool
+	err := s.DB.QueryRow(query, userID).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return enabled, err
+}
+
+func (s *SQLiteDB) SetSendOriginal(userID int64, enabled bool) error {
+	query := `INSERT INTO user_settings (user_id, send_original) VALUES (?, ?)
+			  ON CONFLICT(user_id) DO UPDATE SET send_original = excluded.send_original;`
+	_, err := s.DB.Exec(query, userID, enabled)
+	return err
+}
+
+func (s *SQLiteDB) GetEnhancePrompts(userID int64) (bool, error) {
+	query := `SELECT enhance_prompts FROM user_settings WHERE user_id = ?`
+	var enabled bool
+	err := s.DB.QueryRow(query, userID).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return enabled, err
+}
+
+func (s *SQLiteDB) SetEnhancePrompts(userID int64, enabled bool) error {
+	query := `INSERT INTO user_settings (user_id, enhance_prompts) VALUES (?, ?)
+			  ON CONFLICT(user_id) DO UPDATE SET enhance_prompts = excluded.enhance_prompts;`
+	_, err := s.DB.Exec(query, userID, enabled)
+	return err
+}
+
+func (s *SQLiteDB) SavePendingPrompt(p *PendingPrompt) error {
+	query := `INSERT INTO pending_prompts (user_id, original, enhanced, message_id) VALUES (?, ?, ?, ?)
+			  ON CONFLICT(user_id) DO UPDATE SET original = excluded.original, enhanced = excluded.enhanced,
+			  message_id = excluded.message_id, created_at = CURRENT_TIMESTAMP;`
+	_, err := s.DB.Exec(query, p.UserID, p.Original, p.Enhanced, p.MessageID)
+	return err
+}
+
+func (s *SQLiteDB) TakePendingPrompt(userID int64, messageID int64) (*PendingPrompt, error) {
+	query := `DELETE FROM pending_prompts WHERE user_id = ? AND message_id = ? RETURNING original, enhanced`
+	p := PendingPrompt{UserID: userID, MessageID: messageID}
+	err := s.DB.QueryRow(query, userID, messageID).Scan(&p.Original, &p.Enhanced)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *SQLiteDB) Close() error {
 	if s.DB != nil {
-		s.DB.Close()
+		return s.DB.Close()
 	}
-}
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrNotFound dikembalikan jika baris yang diminta tidak ada.
+var ErrNotFound = errors.New("not found")
+
+// ErrInsufficientCredits dikembalikan jika saldo tidak cukup untuk pengurangan.
+var ErrInsufficientCredits = errors.New("insufficient credits")
+
+type UserState struct {
+	State         string
+	SelectedModel string
+	DraftOptions  map[string]interface{}
+}
+
+type Job struct {
+	ID      int64
+	UserID  int64
+	ChatID  int64
+	ModelID string
+	// Jenis model saat job dibuat: "image" atau "video"
+	Kind      string
+	Prompt    string
+	TaskID    string
+	Status    string
+	ResultURL string
+	MediaName string
+	// file_id Telegram dari dokumen asli yang sudah pernah dikirim
+	DocumentFileID string
+	CreatedAt      time.Time
+}
+
+// Broadcast adalah satu pengumuman admin beserta progres pengirimannya.
+// Penerima diproses berurutan berdasarkan user_id; LastUserID adalah user
+// terakhir yang sudah diproses, jadi pengiriman bisa dilanjutkan setelah restart.
+type Broadcast struct {
+	ID      int64
+	AdminID int64
+	// Chat admin dan pesan progres yang terus di-update
+	ChatID     int64
+	MessageID  int64
+	Text       string
+	Buttons    []BroadcastButton
+	Segment    Segment
+	Status     string
+	LastUserID int64
+	Total      int
+	Sent       int
+	Failed     int
+	Blocked    int
+	CreatedAt  time.Time
+}
+
+type BroadcastButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// Segment memilih penerima broadcast. User yang memblokir bot tidak pernah
+// termasuk.
+type Segment struct {
+	// Kode bahasa, kosong = semua bahasa
+	Lang string
+	// Ikut sertakan user yang belum pernah memilih bahasa (untuk bahasa default)
+	IncludeUnsetLang bool
+	// Hanya user yang aktif dalam N hari terakhir, 0 = semua
+	ActiveDays int
+}
+
+// Alasan entri di credit_ledger.
+const (
+	CreditPurchase    = "purchase"
+	CreditRefund      = "refund"
+	CreditSpend       = "spend"
+	CreditSpendReturn = "spend_return"
+	// Bonus referral untuk pengundang dan user yang diundang; ref = user ID
+	// yang diundang.
+	CreditReferral        = "referral"
+	CreditReferralWelcome = "referral_welcome"
+)
+
+// Status pembayaran.
+const (
+	PaymentPaid     = "paid"
+	PaymentRefunded = "refunded"
+)
+
+// Payment adalah satu pembelian kredit dengan Telegram Stars.
+type Payment struct {
+	// telegram_payment_charge_id, dipakai juga untuk refund
+	ChargeID  string
+	UserID    int64
+	Credits   int
+	Stars     int
+	Payload   string
+	Status    string
+	CreatedAt time.Time
+}
+
+// PendingPrompt adalah prompt yang sudah diperbaiki dan menunggu pilihan user.
+type PendingPrompt struct {
+	UserID   int64
+	Original string
+	Enhanced string
+	// Pesan yang berisi tombol pilihan
+	MessageID int64
+}
+
+// ModerationEntry adalah satu prompt yang diblokir moderasi.
+type ModerationEntry struct {
+	ID     int64
+	UserID int64
+	Prompt string
+	// Pemeriksa yang memblokir ("rules" atau "hook") dan alasannya
+	Source    string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// ReferralStats adalah ringkasan undangan seorang user.
+type ReferralStats struct {
+	Invited int
+	// User undangan yang sudah generate (bonus sudah diberikan)
+	Rewarded int
+	// Total kredit yang didapat dari referral
+	Credits int
+}
+
+// Store is the persistence used by the bot. Every method reports failures to
+// the caller; "no row" is ErrNotFound where a missing row is meaningful.
+type Store interface {
+	// Users
+	// GetUserLanguage returns ErrNotFound if the user never picked a language.
+	GetUserLanguage(userID int64) (string, error)
+	SetUserLanguage(userID int64, langCode string) error
+	// TouchUser records activity and clears a previous block.
+	TouchUser(userID int64) error
+	// SetUserBlocked marks a user who blocked the bot as inactive.
+	SetUserBlocked(userID int64) error
+	// GetUserTier returns ErrNotFound for unknown users.
+	GetUserTier(userID int64) (string, error)
+	SetUserTier(userID int64, tier string) error
+
+	// State & draft. GetUserState returns an IDLE state for unknown users.
+	// All writes to one user's state are atomic with respect to each other.
+	GetUserState(userID int64) (UserState, error)
+	SetUserState(userID int64, state string, modelID string) error
+	// UpdateDraftOption sets a single draft key without rewriting the others.
+	UpdateDraftOption(userID int64, key string, value interface{}) error
+	// UpdateUserState runs fn on the current state inside a transaction with
+	// the user's row locked, then stores the result. If fn returns an error
+	// nothing is written. Use it for batches and read-modify-write updates.
+	UpdateUserState(userID int64, fn func(state *UserState) error) error
+
+	// Settings. Prompt enhancement is off until the user turns it on.
+	GetSendOriginal(userID int64) (bool, error)
+	SetSendOriginal(userID int64, enabled bool) error
+	GetEnhancePrompts(userID int64) (bool, error)
+	SetEnhancePrompts(userID int64, enabled bool) error
+
+	// Pending prompts, at most one per user. TakePendingPrompt removes and
+	// returns the prompt only if it belongs to messageID, else ErrNotFound.
+	SavePendingPrompt(p *PendingPrompt) error
+	TakePendingPrompt(userID int64, messageID int64) (*PendingPrompt, error)
+
+	// Jobs & history. GetJob returns ErrNotFound for unknown IDs.
+	CreateJob(userID int64, chatID int64, modelID string, kind string, prompt string) (int64, error)
+	SetJobTask(jobID int64, taskID string) error
+	FinishJob(jobID int64, status string, resultURL string, mediaName string) error
+	SetJobDocument(jobID int64, fileID string) error
+	// AddJobMessage records a result message sent for a job; GetJobByMessage
+	// finds the job again from a reply to it, or returns ErrNotFound.
+	AddJobMessage(jobID int64, chatID int64, messageID int64) error
+	GetJobByMessage(chatID int64, messageID int64) (*Job, error)
+	GetJob(jobID int64) (*Job, error)
+	// ListJobs returns up to limit of the user's jobs with an ID below before
+	// (0 for the newest), newest first.
+	ListJobs(userID int64, limit int, before int64) ([]Job, error)
+	// CountJobsSince counts the user's jobs of kind created at or after since,
+	// except failed, timed out and canceled ones (those produced nothing).
+	CountJobsSince(userID int64, kind string, since time.Time) (int, error)
+
+	// Broadcasts. SetBroadcastStatus only changes the status if it is still
+	// from, and reports whether it did.
+	CreateBroadcast(bc *Broadcast) (int64, error)
+	GetBroadcast(id int64) (*Broadcast, error)
+	ListBroadcasts(status string) ([]Broadcast, error)
+	SetBroadcastStatus(id int64, from string, to string) (bool, error)
+	SaveBroadcastProgress(bc *Broadcast) error
+	CountRecipients(seg Segment) (int, error)
+	// ListRecipients returns up to limit user IDs greater than afterUserID, ascending.
+	ListRecipients(seg Segment, afterUserID int64, limit int) ([]int64, error)
+
+	// Credits. Every change is a ledger entry; an entry with a non-empty ref
+	// is recorded at most once per reason, and a repeat reports false.
+	// AddCredits returns ErrInsufficientCredits instead of going below zero.
+	AddCredits(userID int64, amount int, reason string, ref string) (bool, error)
+	// ReverseCredits undoes the entry (reason, ref), if any, as newReason.
+	ReverseCredits(reason string, ref string, newReason string) (bool, error)
+	GetCreditBalance(userID int64) (int, error)
+
+	// Payments. RecordPurchase stores the payment and credits the user once
+	// per charge ID. RefundPurchase marks it refunded and takes the credits
+	// back, even below zero; it returns ErrNotFound for unknown charges.
+	RecordPurchase(p *Payment) (bool, error)
+	RefundPurchase(chargeID string) (bool, error)
+	GetPayment(chargeID string) (*Payment, error)
+
+	// Moderation. GetUserBan returns the zero time if the user was never
+	// banned; a ban in the past is kept as the point from which strikes count.
+	// ListModerationLog returns the newest entries first, of all users if
+	// userID is 0.
+	AddModerationLog(e *ModerationEntry) error
+	CountModerationSince(userID int64, since time.Time) (int, error)
+	ListModerationLog(userID int64, limit int) ([]ModerationEntry, error)
+	GetUserBan(userID int64) (time.Time, error)
+	SetUserBan(userID int64, until time.Time) error
+
+	// Referrals. SetReferrer only links users who have not generated
+	// anything yet and never a referral loop; it reports whether it did.
+	// RewardReferral credits bonus to the user and their referrer once and
+	// returns the referrer, or 0 if there is nothing to reward.
+	SetReferrer(userID int64, referrerID int64) (bool, error)
+	RewardReferral(userID int64, bonus int) (int64, error)
+	GetReferralStats(userID int64) (ReferralStats, error)
+
+	// Schema
+	Migrate() error
+	MigrateDownTo(version int) error
+	MigrationStatus() ([]MigrationStatus, error)
+
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Driver yang didukung oleh Open.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// schemaColumns adalah tabel dan kolom yang wajib ada agar bot bisa berjalan.
+var schemaColumns = map[string][]string{
+	"users":           {"user_id", "language_code", "created_at", "last_seen_at", "blocked_at", "tier", "referred_by", "referral_rewarded_at", "banned_until"},
+	"user_states":     {"user_id", "state", "selected_model", "draft_options"},
+	"jobs":            {"job_id", "user_id", "chat_id", "model_id", "kind", "prompt", "task_id", "status", "result_url", "media_name", "document_file_id", "created_at"},
+	"user_settings":   {"user_id", "send_original", "enhance_prompts"},
+	"pending_prompts": {"user_id", "original", "enhanced", "message_id", "created_at"},
+	"job_messages":    {"chat_id", "message_id", "job_id", "created_at"},
+	"moderation_log":  {"log_id", "user_id", "prompt", "source", "reason", "created_at"},
+	"user_credits":    {"user_id", "balance"},
+	"credit_ledger":   {"entry_id", "user_id", "amount", "reason", "ref", "created_at"},
+	"payments":        {"charge_id", "user_id", "credits", "stars", "payload", "status", "created_at"},
+	"broadcasts":      {"broadcast_id", "admin_id", "chat_id", "message_id", "text", "buttons", "segment_lang", "segment_active_days", "status", "last_user_id", "total", "sent", "failed", "blocked", "created_at"},
+}
+
+// Open connects to the store for driver. dsn is a file path for SQLite and a
+// connection URL for PostgreSQL. With migrate set, pending migrations are
+// applied before the store is returned.
+func Open(driver string, dsn string, migrate bool) (Store, error) {
+	var store Store
+	var err error
+	switch driver {
+	case DriverSQLite:
+		store, err = OpenSQLiteDB(dsn)
+	case DriverPostgres:
+		store, err = OpenPostgresDB(dsn)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if migrate {
+		if err := store.Migrate(); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// CheckSchema checks without modifying anything that the database is not
+// newer than this binary and, when fully migrated, that every required table
+// and column exists. A missing SQLite file or pending migrations are not
+// errors: both are handled by Open on start.
+func CheckSchema(driver string, dsn string) error {
+	var m *migrator
+	switch driver {
+	case DriverSQLite:
+		if _, err := os.Stat(dsn); os.IsNotExist(err) {
+			return nil
+		}
+		db, err := OpenSQLiteDB("file:" + dsn + "?mode=ro")
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		m = db.migrator
+	case DriverPostgres:
+		db, err := OpenPostgresDB(dsn)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		m = db.migrator
+	default:
+		return fmt.Errorf("unknown database driver %q", driver)
+	}
+	return m.checkSchema()
+}
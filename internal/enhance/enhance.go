@@ -0,0 +1,109 @@
+// Package enhance menulis ulang prompt singkat menjadi prompt yang lebih
+// detail sebelum dikirim ke model gambar atau video.
+package enhance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Enhancer rewrites prompt for a generation of the given kind ("image" or
+// "video"). It returns only the new prompt text.
+type Enhancer interface {
+	Enhance(ctx context.Context, prompt string, kind string) (string, error)
+}
+
+// ChatClient is an Enhancer backed by an OpenAI-compatible chat completions
+// endpoint, such as a text model on Kie or any self-hosted LLM gateway.
+type ChatClient struct {
+	URL        string
+	APIKey     string
+	Model      string
+	HTTPClient *http.Client
+}
+
+func NewChatClient(apiURL string, apiKey string, model string, timeout time.Duration) *ChatClient {
+	return &ChatClient{
+		URL:        apiURL,
+		APIKey:     apiKey,
+		Model:      model,
+		HTTPClient: &http.Client{Timeout: timeout},
+	}
+}
+
+const systemPrompt = `You improve prompts for an AI %s generator. Rewrite the user's prompt into one detailed prompt: keep the subject and intent, add concrete details about composition, lighting, style and mood%s. Keep the language of the original prompt. Reply with the prompt only, without quotes, labels or explanations.`
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model,omitempty"`
+	Messages []chatMessage `json:"messages"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (c *ChatClient) Enhance(ctx context.Context, prompt string, kind string) (string, error) {
+	extra := ""
+	if kind == "video" {
+		extra = " and describe camera movement and motion"
+	}
+	body, err := json.Marshal(chatRequest{
+		Model: c.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: fmt.Sprintf(systemPrompt, kind, extra)},
+			{Role: "user", Content: prompt},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// Sama seperti hook moderasi: URL bisa berisi token.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", fmt.Errorf("prompt enhancer: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("prompt enhancer: status %d", resp.StatusCode)
+	}
+
+	var result chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("prompt enhancer: %v", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", errors.New("prompt enhancer: no choices in response")
+	}
+	text := strings.Trim(strings.TrimSpace(result.Choices[0].Message.Content), "\"")
+	if text == "" {
+		return "", errors.New("prompt enhancer: empty response")
+	}
+	return text, nil
+}
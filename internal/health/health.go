@@ -0,0 +1,81 @@
+// Package health serves /healthz and /readyz from a list of named checks.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check adalah satu pemeriksaan; Run mengembalikan error jika tidak sehat.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Handler runs all checks concurrently within timeout and answers 200 when
+// every check passes, 503 otherwise. The body lists the result per check.
+func Handler(timeout time.Duration, checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		rep := report{Status: "ok", Checks: make(map[string]string, len(checks))}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, c := range checks {
+			wg.Add(1)
+			go func(c Check) {
+				defer wg.Done()
+				result := "ok"
+				if err := c.Run(ctx); err != nil {
+					result = err.Error()
+				}
+				mu.Lock()
+				rep.Checks[c.Name] = result
+				if result != "ok" {
+					rep.Status = "fail"
+				}
+				mu.Unlock()
+			}(c)
+		}
+		wg.Wait()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if rep.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(rep)
+	})
+}
+
+// Cached wraps a check so its result is reused for ttl. Use it for checks that
+// call external services, so frequent probes don't turn into request spam.
+func Cached(c Check, ttl time.Duration) Check {
+	var mu sync.Mutex
+	var last time.Time
+	var lastErr error
+
+	return Check{
+		Name: c.Name,
+		Run: func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if !last.IsZero() && time.Since(last) < ttl {
+				return lastErr
+			}
+			lastErr = c.Run(ctx)
+			last = time.Now()
+			return lastErr
+		},
+	}
+}
@@ -2,8 +2,12 @@ package i18n
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
 	"strings"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
@@ -15,19 +19,19 @@ type Localizer struct {
 	defaultLang  string
 }
 
-func NewLocalizer(defaultLang string) *Localizer {
+func NewLocalizer(dir string, defaultLang string) *Localizer {
 	l := &Localizer{
 		translations: make(map[string]map[string]string),
 		defaultLang:  defaultLang,
 	}
-	l.loadTranslations()
+	l.loadTranslations(dir)
 	return l
 }
 
-func (l *Localizer) loadTranslations() {
-	files, err := filepath.Glob("locales/*.json")
+func (l *Localizer) loadTranslations(dir string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
 	if err != nil {
-		log.Printf("Error finding locale files: %v\n", err)
+		slog.Error("failed to find locale files", "dir", dir, "err", err)
 		return
 	}
 
@@ -35,20 +39,20 @@ func (l *Localizer) loadTranslations() {
 		langCode := strings.TrimSuffix(filepath.Base(file), ".json")
 		content, err := os.ReadFile(file)
 		if err != nil {
-			log.Printf("Error reading locale file %s: %v\n", file, err)
+			slog.Error("failed to read locale file", "file", file, "err", err)
 			continue
 		}
 
 		var data map[string]string
 		if err := json.Unmarshal(content, &data); err != nil {
-			log.Printf("Error parsing locale file %s: %v\n", file, err)
+			slog.Error("failed to parse locale file", "file", file, "err", err)
 			continue
 		}
 
 		l.mu.Lock()
 		l.translations[langCode] = data
 		l.mu.Unlock()
-		log.Printf("Loaded language: %s\n", langCode)
+		slog.Debug("loaded language", "lang", langCode)
 	}
 }
 
@@ -75,3 +79,68 @@ func (l *Localizer) Get(lang, key string) string {
 	return key
 }
 
+// formatVerb mencocokkan verb fmt seperti %s, %d, %.1f (tanpa %%).
+var formatVerb = regexp.MustCompile(`%[-+# 0]*[0-9.]*[a-zA-Z]`)
+
+// CheckLocales validates every locale file in dir against the default
+// language: files must parse, and every key of the default language must
+// exist with the same format placeholders.
+func CheckLocales(dir string, defaultLang string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	all := make(map[string]map[string]string)
+	var errs []error
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var data map[string]string
+		if err := json.Unmarshal(content, &data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", file, err))
+			continue
+		}
+		all[strings.TrimSuffix(filepath.Base(file), ".json")] = data
+	}
+
+	base, ok := all[defaultLang]
+	if !ok {
+		errs = append(errs, fmt.Errorf("no locale file for default language %q", defaultLang))
+		return errors.Join(errs...)
+	}
+
+	keys := make([]string, 0, len(base))
+	for key := range base {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	langs := make([]string, 0, len(all))
+	for lang := range all {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	for _, lang := range langs {
+		if lang == defaultLang {
+			continue
+		}
+		for _, key := range keys {
+			val, ok := all[lang][key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: missing key %q", lang, key))
+				continue
+			}
+			want := strings.Join(formatVerb.FindAllString(strings.ReplaceAll(base[key], "%%", ""), -1), " ")
+			got := strings.Join(formatVerb.FindAllString(strings.ReplaceAll(val, "%%", ""), -1), " ")
+			if want != got {
+				errs = append(errs, fmt.Errorf("%s: key %q has placeholders [%s], want [%s]", lang, key, got, want))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
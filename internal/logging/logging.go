@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var secretPatterns = []*regexp.Regexp{
+	// Token bot Telegram di URL API dan URL file: .../bot123456:ABC-xyz/...
+	regexp.MustCompile(`bot\d+:[A-Za-z0-9_-]+`),
+	// Header Authorization
+	regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`),
+}
+
+// New creates a logger writing to w. level is one of debug, info, warn or
+// error; format is "text" or "json". Every literal in secrets, plus bot tokens
+// and bearer credentials, is redacted from messages and attribute values.
+func New(w io.Writer, level string, format string, secrets ...string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text", "":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+
+	var literals []string
+	for _, s := range secrets {
+		if s != "" {
+			literals = append(literals, s)
+		}
+	}
+	return slog.New(&redactHandler{next: h, secrets: literals}), nil
+}
+
+// redactHandler menyaring secret dari pesan dan atribut sebelum diteruskan.
+type redactHandler struct {
+	next    slog.Handler
+	secrets []string
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	clean := slog.NewRecord(r.Time, r.Level, h.redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		clean.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, clean)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		clean[i] = h.redactAttr(a)
+	}
+	return &redactHandler{next: h.next.WithAttrs(clean), secrets: h.secrets}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name), secrets: h.secrets}
+}
+
+func (h *redactHandler) redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		clean := make([]any, len(group))
+		for i, ga := range group {
+			clean[i] = h.redactAttr(ga)
+		}
+		return slog.Group(a.Key, clean...)
+	case slog.KindAny:
+		// Error dan tipe lain di-render ke string dulu supaya bisa disaring.
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, h.redact(err.Error()))
+		}
+		if s, ok := v.Any().(fmt.Stringer); ok {
+			return slog.String(a.Key, h.redact(s.String()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+func (h *redactHandler) redact(s string) string {
+	for _, secret := range h.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			if strings.HasPrefix(match, "bot") {
+				return "bot" + redacted
+			}
+			return "Bearer " + redacted
+		})
+	}
+	return s
+}
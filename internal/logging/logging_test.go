@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const token = "123456:ABC-secret_token"
+
+func TestRedact(t *testing.T) {
+	cases := []struct {
+		name string
+		log  func(lg *slog.Logger)
+		leak string
+		want string
+	}{
+		{"literal in message", func(lg *slog.Logger) {
+			lg.Info("token is " + token)
+		}, token, "token is [REDACTED]"},
+		{"literal in attribute", func(lg *slog.Logger) {
+			lg.Info("config", "kie_key", "kie-secret-key")
+		}, "kie-secret-key", "kie_key=[REDACTED]"},
+		{"bot token in URL", func(lg *slog.Logger) {
+			lg.Info("request failed", "url", "https://api.telegram.org/bot987:XYZ-other/getMe")
+		}, "987:XYZ-other", "url=https://api.telegram.org/bot[REDACTED]/getMe"},
+		{"bot token in error", func(lg *slog.Logger) {
+			lg.Error("download failed", "err", fmt.Errorf("get https://api.telegram.org/file/bot%s/photo.jpg: EOF", token))
+		}, token, "file/bot[REDACTED]/photo.jpg"},
+		{"bearer header", func(lg *slog.Logger) {
+			lg.Warn("upstream said", "body", "Authorization: Bearer sk-live.abc/123=")
+		}, "sk-live.abc/123=", "Authorization: Bearer [REDACTED]"},
+		{"bearer lower case", func(lg *slog.Logger) {
+			lg.Warn("auth bearer sk-other")
+		}, "sk-other", "auth Bearer [REDACTED]"},
+		{"group attribute", func(lg *slog.Logger) {
+			lg.Info("kie", slog.Group("req", "auth", "Bearer sk-group"))
+		}, "sk-group", "req.auth=\"Bearer [REDACTED]\""},
+		{"With attribute", func(lg *slog.Logger) {
+			lg.With("err", errors.New("bad key kie-secret-key")).Info("x")
+		}, "kie-secret-key", "err=\"bad key [REDACTED]\""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			lg, err := New(&buf, "info", "text", token, "kie-secret-key", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.log(lg)
+			out := buf.String()
+			if strings.Contains(out, c.leak) {
+				t.Fatalf("secret %q leaked: %s", c.leak, out)
+			}
+			if !strings.Contains(out, c.want) {
+				t.Fatalf("output %q does not contain %q", out, c.want)
+			}
+		})
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	var buf bytes.Buffer
+	lg, err := New(&buf, "debug", "json", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.Debug("getUpdates", "url", "https://api.telegram.org/bot"+token+"/getUpdates")
+	if out := buf.String(); strings.Contains(out, token) || !strings.Contains(out, `"url":"https://api.telegram.org/bot[REDACTED]/getUpdates"`) {
+		t.Fatalf("output = %s", out)
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "verbose", "text"); err == nil {
+		t.Fatal("invalid level accepted")
+	}
+	if _, err := New(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Fatal("invalid format accepted")
+	}
+}
@@ -0,0 +1,186 @@
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store menyimpan file hasil generate di disk lokal dan menyajikannya lewat
+// link HTTP yang ditandatangani (HMAC) dan punya masa berlaku.
+type Store struct {
+	Dir       string
+	PublicURL string
+	Retention time.Duration
+	LinkTTL   time.Duration
+	secret    []byte
+}
+
+func NewStore(dir, publicURL, secret string, retention, linkTTL time.Duration) (*Store, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("media secret is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create media dir: %v", err)
+	}
+
+	return &Store{
+		Dir:       dir,
+		PublicURL: strings.TrimRight(publicURL, "/"),
+		Retention: retention,
+		LinkTTL:   linkTTL,
+		secret:    []byte(secret),
+	}, nil
+}
+
+// Save writes r to the store under name. The file is written to a temporary
+// file first so readers never see a partially downloaded result.
+func (s *Store) Save(name string, r io.Reader) (int64, error) {
+	if !validName(name) {
+		return 0, fmt.Errorf("invalid media name %q", name)
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), s.Path(name)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *Store) Path(name string) string {
+	return filepath.Join(s.Dir, name)
+}
+
+func (s *Store) Open(name string) (*os.File, error) {
+	if !validName(name) {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(s.Path(name))
+}
+
+// Exists reports whether name is still kept in the store.
+func (s *Store) Exists(name string) bool {
+	if !validName(name) {
+		return false
+	}
+	_, err := os.Stat(s.Path(name))
+	return err == nil
+}
+
+// SignedURL returns a public link for name that is valid for LinkTTL.
+func (s *Store) SignedURL(name string) string {
+	exp := strconv.FormatInt(time.Now().Add(s.LinkTTL).Unix(), 10)
+	q := url.Values{}
+	q.Set("exp", exp)
+	q.Set("sig", s.sign(name, exp))
+	return fmt.Sprintf("%s/media/%s?%s", s.PublicURL, url.PathEscape(name), q.Encode())
+}
+
+func (s *Store) sign(name, exp string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(name + "\n" + exp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Store) verify(name, exp, sig string) bool {
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expUnix {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.sign(name, exp)))
+}
+
+// ServeHTTP melayani GET /media/<name>?exp=...&sig=... dengan dukungan Range
+// (dibutuhkan player video).
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/media/")
+	q := r.URL.Query()
+	if !validName(name) || !s.verify(name, q.Get("exp"), q.Get("sig")) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	f, err := s.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// RunJanitor menghapus file yang lebih tua dari Retention secara berkala.
+func (s *Store) RunJanitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.cleanup()
+		<-ticker.C
+	}
+}
+
+func (s *Store) cleanup() {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		slog.Error("media cleanup failed", "dir", s.Dir, "err", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-s.Retention)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.Dir, e.Name())); err != nil {
+			slog.Error("media cleanup failed", "file", e.Name(), "err", err)
+		}
+	}
+}
+
+func validName(name string) bool {
+	if name == "" || strings.HasPrefix(name, ".") {
+		return false
+	}
+	return !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,50 @@
+package metrics
+
+// Metric yang dicatat oleh bot. Nama label dijaga tetap sedikit supaya
+// jumlah series tidak meledak (model dan operasi saja, tanpa user ID).
+var (
+	UpdatesTotal = NewCounter("kiebot_updates_total",
+		"Telegram updates handled, by update type.", "type")
+
+	UpdatesQueued = NewGauge("kiebot_updates_queued",
+		"Telegram updates waiting in the dispatcher or being handled.")
+
+	JobsTotal = NewCounter("kiebot_jobs_total",
+		"Generation jobs finished, by model and outcome (success, failed, timeout, canceled).", "model", "outcome")
+
+	ActiveJobs = NewGauge("kiebot_active_jobs",
+		"Generation jobs currently waiting for Kie or being delivered.")
+
+	KieRequestDuration = NewHistogram("kiebot_kie_request_duration_seconds",
+		"Latency of Kie API requests, by operation (create, poll, upload).", DefaultBuckets, "op")
+
+	KieErrorsTotal = NewCounter("kiebot_kie_errors_total",
+		"Failed Kie API requests, by operation.", "op")
+
+	PollIterationsTotal = NewCounter("kiebot_poll_iterations_total",
+		"Kie task status polls, by model.", "model")
+
+	DeliveriesTotal = NewCounter("kiebot_deliveries_total",
+		"Results delivered to Telegram, by Bot API method or \"link\" for the download link fallback.", "method")
+
+	TelegramRateLimitedTotal = NewCounter("kiebot_telegram_rate_limited_total",
+		"Bot API requests answered with 429 Too Many Requests, by method.", "method")
+
+	ModerationBlockedTotal = NewCounter("kiebot_moderation_blocked_total",
+		"Prompts blocked by moderation, by source (rules, hook).", "source")
+
+	ModerationErrorsTotal = NewCounter("kiebot_moderation_errors_total",
+		"Moderation checks that failed and let the prompt through.")
+
+	PaymentsTotal = NewCounter("kiebot_payments_total",
+		"Telegram Stars credit purchases, by outcome (paid, refunded).", "outcome")
+
+	PromptEnhanceTotal = NewCounter("kiebot_prompt_enhance_total",
+		"Prompt enhancer calls, by outcome (enhanced, failed).", "outcome")
+
+	PromptEnhanceChoiceTotal = NewCounter("kiebot_prompt_enhance_choice_total",
+		"Choices made on enhanced prompts, by choice (use, edit, original).", "choice")
+
+	UploadErrorsTotal = NewCounter("kiebot_telegram_upload_errors_total",
+		"Failed result uploads to Telegram, by Bot API method.", "method")
+)
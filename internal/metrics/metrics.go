@@ -0,0 +1,258 @@
+// Package metrics implements the small subset of the Prometheus text
+// exposition format the bot needs (counters, gauges and histograms with
+// labels) without pulling in the Prometheus client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets cocok untuk latency request HTTP (dalam detik).
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry menyimpan semua metric yang akan ditampilkan di /metrics.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// Default adalah registry yang dipakai oleh NewCounter, NewGauge dan NewHistogram.
+var Default = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mu.Unlock()
+}
+
+// Write writes every registered metric in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler returns an http.Handler serving the default registry.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.Write(w)
+	})
+}
+
+// desc adalah nama, keterangan dan nama label sebuah metric beserta
+// nilai-nilainya per kombinasi label.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64 // hanya untuk histogram, tidak kumulatif
+	count       uint64
+}
+
+func newDesc(name, help, kind string, labels []string) *desc {
+	return &desc{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+}
+
+// get mengembalikan series untuk kombinasi label; d.mu harus sudah dikunci.
+func (d *desc) get(labelValues []string) *series {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := d.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		d.series[key] = s
+	}
+	return s
+}
+
+// sorted mengembalikan salinan series yang diurutkan supaya output stabil.
+func (d *desc) sorted() []series {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]series, 0, len(d.series))
+	for _, s := range d.series {
+		cp := *s
+		cp.buckets = append([]uint64(nil), s.buckets...)
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].labelValues, "\xff") < strings.Join(out[j].labelValues, "\xff")
+	})
+	return out
+}
+
+func (d *desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.ReplaceAll(d.help, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// Counter is a monotonically increasing value, optionally split by labels.
+type Counter struct{ d *desc }
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{d: newDesc(name, help, "counter", labels)}
+	Default.register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.d.mu.Lock()
+	c.d.get(labelValues).value += v
+	c.d.mu.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.d.header(w)
+	for _, s := range c.d.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.d.name, formatLabels(c.d.labels, s.labelValues, "", ""), formatValue(s.value))
+	}
+}
+
+// Gauge is a value that can go up and down, optionally split by labels.
+type Gauge struct{ d *desc }
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{d: newDesc(name, help, "gauge", labels)}
+	Default.register(g)
+	return g
+}
+
+func (g *Gauge) Inc(labelValues ...string) { g.Add(1, labelValues...) }
+
+func (g *Gauge) Dec(labelValues ...string) { g.Add(-1, labelValues...) }
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.d.mu.Lock()
+	g.d.get(labelValues).value += v
+	g.d.mu.Unlock()
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.d.mu.Lock()
+	g.d.get(labelValues).value = v
+	g.d.mu.Unlock()
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.d.header(w)
+	for _, s := range g.d.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", g.d.name, formatLabels(g.d.labels, s.labelValues, "", ""), formatValue(s.value))
+	}
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	d       *desc
+	buckets []float64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	h := &Histogram{d: newDesc(name, help, "histogram", labels), buckets: b}
+	Default.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.d.mu.Lock()
+	defer h.d.mu.Unlock()
+
+	s := h.d.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.buckets))
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.buckets[i]++
+			break
+		}
+	}
+	s.value += v
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.d.header(w)
+	for _, s := range h.d.sorted() {
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			if s.buckets != nil {
+				cumulative += s.buckets[i]
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.d.name, formatLabels(h.d.labels, s.labelValues, "le", formatValue(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.d.name, formatLabels(h.d.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.d.name, formatLabels(h.d.labels, s.labelValues, "", ""), formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.d.name, formatLabels(h.d.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+// formatLabels menulis {a="x",b="y"}; extraName/extraValue dipakai untuk label "le".
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	parts := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		parts = append(parts, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+`="`+extraValue+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden")
+
+// testRegistry membuat metric contoh di registry tersendiri, jadi output
+// tidak ikut berubah saat metric bot ditambah.
+func testRegistry() *Registry {
+	jobs := NewCounter("test_jobs_total", "Jobs finished,\nby model and outcome.", "model", "outcome")
+	jobs.Inc("veo-3", "success")
+	jobs.Add(2, "nano-banana", "failed")
+	jobs.Inc("nano-banana", "success")
+
+	plain := NewCounter("test_plain_total", "A counter without labels.")
+	plain.Add(0.5)
+
+	escaped := NewCounter("test_escaped_total", "Label values with special characters.", "method")
+	escaped.Inc(`say "hi"` + "\n" + `C:\tmp`)
+
+	active := NewGauge("test_active", "Gauge going up and down.")
+	active.Inc()
+	active.Inc()
+	active.Dec()
+	queued := NewGauge("test_queued", "Gauge set per label.", "queue")
+	queued.Set(-3, "b")
+	queued.Set(7, "a")
+
+	latency := NewHistogram("test_latency_seconds", "Histogram with labels.", []float64{0.1, 1}, "op")
+	latency.Observe(0.05, "poll")
+	latency.Observe(0.1, "poll")
+	latency.Observe(0.5, "poll")
+	latency.Observe(30, "poll")
+	latency.Observe(2, "create")
+
+	r := &Registry{}
+	for _, c := range []collector{jobs, plain, escaped, active, queued, latency} {
+		r.register(c)
+	}
+	return r
+}
+
+func TestWriteGolden(t *testing.T) {
+	var buf bytes.Buffer
+	testRegistry().Write(&buf)
+
+	golden := filepath.Join("testdata", "exposition.golden")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Fatalf("exposition mismatch (run with -update to accept)\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHandlerContentType(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("content type = %q", got)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte("# TYPE kiebot_jobs_total counter\n")) {
+		t.Fatalf("bot metrics missing from /metrics:\n%s", rec.Body.String())
+	}
+}
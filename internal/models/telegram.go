@@ -1,17 +1,34 @@
 package models
 
 type TelegramUpdate struct {
-	UpdateID      int64            `json:"update_id"`
-	Message       *TelegramMessage `json:"message"`
-	CallbackQuery *CallbackQuery   `json:"callback_query"`
+	UpdateID           int64               `json:"update_id"`
+	Message            *TelegramMessage    `json:"message"`
+	CallbackQuery      *CallbackQuery      `json:"callback_query"`
+	InlineQuery        *InlineQuery        `json:"inline_query"`
+	ChosenInlineResult *ChosenInlineResult `json:"chosen_inline_result"`
+	PreCheckoutQuery   *PreCheckoutQuery   `json:"pre_checkout_query"`
 }
 
 type TelegramMessage struct {
-	MessageID int64       `json:"message_id"`
-	From      *User       `json:"from"`
-	Chat      *Chat       `json:"chat"`
-	Text      string      `json:"text"`
-	Photo     []PhotoSize `json:"photo"` 
+	MessageID    int64       `json:"message_id"`
+	From         *User       `json:"from"`
+	Chat         *Chat       `json:"chat"`
+	Text         string      `json:"text"`
+	Photo        []PhotoSize `json:"photo"`
+	Document     *Document   `json:"document"`
+	MediaGroupID string      `json:"media_group_id"`
+
+	ReplyToMessage *TelegramMessage `json:"reply_to_message"`
+
+	SuccessfulPayment *SuccessfulPayment `json:"successful_payment"`
+	RefundedPayment   *RefundedPayment   `json:"refunded_payment"`
+}
+
+type Document struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	FileSize int    `json:"file_size"`
 }
 
 type PhotoSize struct {
@@ -22,10 +39,50 @@ type PhotoSize struct {
 }
 
 type CallbackQuery struct {
-	ID      string           `json:"id"`
-	From    *User            `json:"from"`
-	Message *TelegramMessage `json:"message"`
-	Data    string           `json:"data"`
+	ID              string           `json:"id"`
+	From            *User            `json:"from"`
+	Message         *TelegramMessage `json:"message"`
+	InlineMessageID string           `json:"inline_message_id"`
+	Data            string           `json:"data"`
+}
+
+type InlineQuery struct {
+	ID     string `json:"id"`
+	From   *User  `json:"from"`
+	Query  string `json:"query"`
+	Offset string `json:"offset"`
+}
+
+// ChosenInlineResult hanya dikirim Telegram jika "inline feedback" aktif di BotFather.
+type ChosenInlineResult struct {
+	ResultID        string `json:"result_id"`
+	From            *User  `json:"from"`
+	Query           string `json:"query"`
+	InlineMessageID string `json:"inline_message_id"`
+}
+
+// PreCheckoutQuery harus dijawab dengan answerPreCheckoutQuery dalam 10 detik.
+type PreCheckoutQuery struct {
+	ID             string `json:"id"`
+	From           *User  `json:"from"`
+	Currency       string `json:"currency"`
+	TotalAmount    int    `json:"total_amount"`
+	InvoicePayload string `json:"invoice_payload"`
+}
+
+type SuccessfulPayment struct {
+	Currency                string `json:"currency"`
+	TotalAmount             int    `json:"total_amount"`
+	InvoicePayload          string `json:"invoice_payload"`
+	TelegramPaymentChargeID string `json:"telegram_payment_charge_id"`
+	ProviderPaymentChargeID string `json:"provider_payment_charge_id"`
+}
+
+type RefundedPayment struct {
+	Currency                string `json:"currency"`
+	TotalAmount             int    `json:"total_amount"`
+	InvoicePayload          string `json:"invoice_payload"`
+	TelegramPaymentChargeID string `json:"telegram_payment_charge_id"`
 }
 
 type User struct {
@@ -66,13 +123,88 @@ type SendPhotoRequest struct {
 	Caption string `json:"caption,omitempty"`
 }
 
+type EditInlineMessageTextRequest struct {
+	InlineMessageID string      `json:"inline_message_id"`
+	Text            string      `json:"text"`
+	ParseMode       string      `json:"parse_mode,omitempty"`
+	ReplyMarkup     interface{} `json:"reply_markup,omitempty"`
+}
+
+type EditInlineMessageMediaRequest struct {
+	InlineMessageID string          `json:"inline_message_id"`
+	Media           InputMediaPhoto `json:"media"`
+	ReplyMarkup     interface{}     `json:"reply_markup,omitempty"`
+}
+
+type InputMediaPhoto struct {
+	Type      string `json:"type"`
+	Media     string `json:"media"`
+	Caption   string `json:"caption,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+type AnswerInlineQueryRequest struct {
+	InlineQueryID string                     `json:"inline_query_id"`
+	Results       []InlineQueryResultArticle `json:"results"`
+	CacheTime     int                        `json:"cache_time"`
+	IsPersonal    bool                       `json:"is_personal"`
+}
+
+type InlineQueryResultArticle struct {
+	Type                string                `json:"type"`
+	ID                  string                `json:"id"`
+	Title               string                `json:"title"`
+	Description         string                `json:"description,omitempty"`
+	InputMessageContent InputTextMessage      `json:"input_message_content"`
+	ReplyMarkup         *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type InputTextMessage struct {
+	MessageText string `json:"message_text"`
+	ParseMode   string `json:"parse_mode,omitempty"`
+}
+
+type SendDocumentRequest struct {
+	ChatID   int64  `json:"chat_id"`
+	Document string `json:"document"`
+	Caption  string `json:"caption,omitempty"`
+}
+
+// SendInvoiceRequest untuk pembayaran Telegram Stars: currency "XTR",
+// provider_token kosong, dan tepat satu harga.
+type SendInvoiceRequest struct {
+	ChatID      int64          `json:"chat_id"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Payload     string         `json:"payload"`
+	Currency    string         `json:"currency"`
+	Prices      []LabeledPrice `json:"prices"`
+}
+
+type LabeledPrice struct {
+	Label  string `json:"label"`
+	Amount int    `json:"amount"`
+}
+
+type AnswerPreCheckoutQueryRequest struct {
+	PreCheckoutQueryID string `json:"pre_checkout_query_id"`
+	Ok                 bool   `json:"ok"`
+	ErrorMessage       string `json:"error_message,omitempty"`
+}
+
+type RefundStarPaymentRequest struct {
+	UserID                  int64  `json:"user_id"`
+	TelegramPaymentChargeID string `json:"telegram_payment_charge_id"`
+}
+
 type InlineKeyboardMarkup struct {
 	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
 }
 
 type InlineKeyboardButton struct {
 	Text         string `json:"text"`
-	CallbackData string `json:"callback_data"`
+	CallbackData string `json:"callback_data,omitempty"`
+	URL          string `json:"url,omitempty"`
 }
 
 type SendChatActionRequest struct {
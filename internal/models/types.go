@@ -1,10 +1,119 @@
 package models
 
+import "time"
+
 type Config struct {
 	TelegramToken string
 	KieAPIKey     string
+	DBDriver      string // "sqlite" atau "postgres"
 	DBPath        string
+	DatabaseURL   string
 	DefaultLang   string
+	ModelsPath    string
+	LocalesDir    string
+
+	// Base URL Bot API, bisa diarahkan ke Bot API server lokal atau server uji
+	TelegramAPIURL string
+
+	// User ID Telegram yang boleh memakai perintah admin
+	AdminIDs []int64
+
+	// Generate
+	PollInterval       time.Duration
+	TaskTimeout        time.Duration
+	MaxImageInputs     int
+	CaptionPromptMax   int
+	InlineDefaultModel string
+	// Model edit saat user membalas pesan hasil (kosong = fitur mati)
+	EditDefaultModel string
+	// Model video untuk tombol "Animate" pada hasil gambar (kosong = mati)
+	AnimateModel string
+
+	// Kuota per tier user -> jenis model ("image"/"video"). Tier yang tidak
+	// ada di sini, atau jenis yang tidak disebut, tidak dibatasi.
+	Quotas map[string]map[string]QuotaLimit
+	// Zona waktu untuk reset kuota harian/mingguan/bulanan
+	QuotaTimezone string
+
+	// Paket kredit yang dijual dengan Telegram Stars (kosong = tidak dijual)
+	// dan harga kredit per generate setelah kuota gratis habis.
+	CreditPackages []CreditPackage
+	CreditCosts    map[string]int
+	// Bonus kredit untuk pengundang dan user yang diundang (0 = tanpa bonus)
+	ReferralBonus int
+
+	// Moderasi prompt: aturan lokal, hook eksternal (opsional), dan ban
+	// sementara setelah ModerationStrikes prompt diblokir dalam
+	// ModerationStrikeWindow (0 = tidak pernah ban).
+	ModerationBlocklist    []string
+	ModerationRulesFile    string
+	ModerationHookURL      string
+	ModerationHookTimeout  time.Duration
+	ModerationStrikes      int
+	ModerationStrikeWindow time.Duration
+	ModerationBanDuration  time.Duration
+
+	// Prompt enhancer: endpoint chat completions yang kompatibel dengan
+	// OpenAI (kosong = fitur mati). Key kosong memakai KieAPIKey.
+	EnhanceAPIURL  string
+	EnhanceAPIKey  string
+	EnhanceModel   string
+	EnhanceTimeout time.Duration
+
+	// Dispatcher update: jumlah chat yang diproses paralel dan batas antrean
+	UpdateWorkers   int
+	UpdateQueueSize int
+
+	// HTTP client
+	KieHTTPTimeout time.Duration
+	UploadTimeout  time.Duration
+
+	// Kirim semua hasil sebagai dokumen agar tidak dikompres Telegram
+	SendAsDocument bool
+
+	// HTTP server (media proxy). Kosongkan HTTPAddr untuk menonaktifkan.
+	HTTPAddr       string
+	MediaDir       string
+	MediaPublicURL string
+	MediaSecret    string
+	MediaRetention time.Duration
+	MediaLinkTTL   time.Duration
+
+	LogLevel  string
+	LogFormat string
+}
+
+// QuotaLimit adalah jumlah generate yang boleh dipakai per periode.
+type QuotaLimit struct {
+	Limit  int
+	Period string // "day", "week" atau "month"
+}
+
+// CreditPackage adalah satu pilihan pembelian: Credits kredit seharga Stars ⭐.
+type CreditPackage struct {
+	Credits int
+	Stars   int
+}
+
+// DefaultTier adalah tier untuk user yang belum pernah diberi tier.
+const DefaultTier = "free"
+
+// DBSource returns the data source for the configured driver: the file path
+// for SQLite, the connection URL for PostgreSQL.
+func (c *Config) DBSource() string {
+	if c.DBDriver == "postgres" {
+		return c.DatabaseURL
+	}
+	return c.DBPath
+}
+
+func (c *Config) IsAdmin(userID int64) bool {
+	for _, id := range c.AdminIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
 }
 
 type UserSession struct {
@@ -0,0 +1,69 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Hook asks an external HTTP service to moderate the prompt. The service gets
+// a POST with {"user_id": ..., "prompt": "..."} and answers 200 with
+// {"blocked": true|false, "reason": "..."}.
+type Hook struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+func NewHook(hookURL string, timeout time.Duration) *Hook {
+	return &Hook{
+		URL:        hookURL,
+		HTTPClient: &http.Client{Timeout: timeout},
+	}
+}
+
+type hookRequest struct {
+	UserID int64  `json:"user_id"`
+	Prompt string `json:"prompt"`
+}
+
+type hookResponse struct {
+	Blocked bool   `json:"blocked"`
+	Reason  string `json:"reason"`
+}
+
+func (h *Hook) Check(ctx context.Context, userID int64, prompt string) (Verdict, error) {
+	body, err := json.Marshal(hookRequest{UserID: userID, Prompt: prompt})
+	if err != nil {
+		return Verdict{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		// URL hook bisa berisi token; jangan ikut ditulis ke log.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return Verdict{}, fmt.Errorf("moderation hook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("moderation hook: status %d", resp.StatusCode)
+	}
+
+	var result hookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Verdict{}, fmt.Errorf("moderation hook: %v", err)
+	}
+	return Verdict{Blocked: result.Blocked, Source: "hook", Reason: result.Reason}, nil
+}
@@ -0,0 +1,66 @@
+// Package moderation memeriksa prompt sebelum job dibuat, supaya prompt yang
+// melanggar tidak sampai ke Kie dan tidak memakan kuota atau kredit.
+package moderation
+
+import (
+	"context"
+	"time"
+)
+
+// Verdict is the result of a moderation check.
+type Verdict struct {
+	Blocked bool
+	// Source is the moderator that blocked the prompt ("rules" or "hook").
+	Source string
+	// Reason is for the admin review log and is never shown to the user.
+	Reason string
+}
+
+// Moderator checks a prompt. An error means the prompt could not be checked,
+// not that it was blocked.
+type Moderator interface {
+	Check(ctx context.Context, userID int64, prompt string) (Verdict, error)
+}
+
+// Chain runs moderators in order and stops at the first block. A moderator
+// that fails does not stop the others; its error is returned only if nothing
+// blocked the prompt.
+type Chain []Moderator
+
+func (c Chain) Check(ctx context.Context, userID int64, prompt string) (Verdict, error) {
+	var firstErr error
+	for _, m := range c {
+		v, err := m.Check(ctx, userID, prompt)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if v.Blocked {
+			return v, nil
+		}
+	}
+	return Verdict{}, firstErr
+}
+
+// New builds the moderators that are configured: local rules from blocklist
+// and rulesFile, then the external hook if hookURL is set. It returns nil if
+// nothing is configured.
+func New(blocklist []string, rulesFile string, hookURL string, hookTimeout time.Duration) (Moderator, error) {
+	var chain Chain
+	rules, err := LoadRules(blocklist, rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	if rules.Len() > 0 {
+		chain = append(chain, rules)
+	}
+	if hookURL != "" {
+		chain = append(chain, NewHook(hookURL, hookTimeout))
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
@@ -0,0 +1,91 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rules blocks prompts that contain a blocklisted word or phrase, or match a
+// regular expression. Matching is case-insensitive.
+type Rules struct {
+	rules []rule
+}
+
+type rule struct {
+	// Teks aturan seperti di config, dipakai sebagai alasan di log admin
+	name string
+	re   *regexp.Regexp
+}
+
+// LoadRules compiles the blocklist and, if rulesFile is set, the rules in that
+// file: one word or phrase per line, or a regular expression prefixed with
+// "re:". Empty lines and lines starting with "#" are skipped.
+func LoadRules(blocklist []string, rulesFile string) (*Rules, error) {
+	r := &Rules{}
+	for _, word := range blocklist {
+		if err := r.add(word); err != nil {
+			return nil, err
+		}
+	}
+	if rulesFile == "" {
+		return r, nil
+	}
+
+	f, err := os.Open(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := r.add(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", rulesFile, lineNo, err)
+		}
+	}
+	return r, scanner.Err()
+}
+
+func (r *Rules) add(spec string) error {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil
+	}
+	var pattern string
+	if expr, ok := strings.CutPrefix(spec, "re:"); ok {
+		pattern = "(?i)" + expr
+	} else {
+		// Kata/frasa utuh saja, jadi "ass" tidak memblokir "class".
+		pattern = `(?i)(^|\W)` + regexp.QuoteMeta(spec) + `($|\W)`
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid rule %q: %v", spec, err)
+	}
+	r.rules = append(r.rules, rule{name: spec, re: re})
+	return nil
+}
+
+// Len returns the number of rules.
+func (r *Rules) Len() int {
+	return len(r.rules)
+}
+
+func (r *Rules) Check(ctx context.Context, userID int64, prompt string) (Verdict, error) {
+	for _, rl := range r.rules {
+		if rl.re.MatchString(prompt) {
+			return Verdict{Blocked: true, Source: "rules", Reason: rl.name}, nil
+		}
+	}
+	return Verdict{}, nil
+}